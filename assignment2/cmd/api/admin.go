@@ -0,0 +1,252 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"golang.assignment2.com/internal/data"
+	"golang.assignment2.com/internal/validator"
+)
+
+func (app *application) listUsersHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Search    string
+		Activated *bool
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Search = app.readString(qs, "q", "")
+	if s := qs.Get("activated"); s != "" {
+		activated, err := strconv.ParseBool(s)
+		if err != nil {
+			v.AddError("activated", "must be a boolean value")
+		}
+		input.Activated = &activated
+	}
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readCSV(qs, "sort", []string{"id"})
+	input.Filters.SortSafelist = []string{"id", "name", "email", "created_at", "-id", "-name", "-email", "-created_at"}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	users, metadata, err := app.models.Users.GetAll(input.Search, input.Activated, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	headers := app.paginationLinks(r, &metadata)
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"users": users, "metadata": metadata}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) readUser(w http.ResponseWriter, r *http.Request) (*data.User, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+	user, err := app.models.Users.Get(id)
+	if err != nil {
+		app.dataErrorResponse(w, r, err)
+		return nil, false
+	}
+	return user, true
+}
+
+func (app *application) showUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUser(w, r)
+	if !ok {
+		return
+	}
+	app.writeProfile(w, r, user)
+}
+
+type updateUserInput struct {
+	Activated *bool `json:"activated"`
+	Disabled  *bool `json:"disabled"`
+	Version   *int  `json:"version"`
+}
+
+func (app *application) updateUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUser(w, r)
+	if !ok {
+		return
+	}
+	var input updateUserInput
+	err := app.decodeRequest(w, r, &input)
+	if err != nil {
+		app.decodeErrorResponse(w, r, err)
+		return
+	}
+	if input.Version != nil && *input.Version != user.Version {
+		app.editConflictResponse(w, r)
+		return
+	}
+	changed := false
+	if input.Activated != nil && *input.Activated != user.Activated {
+		user.Activated = *input.Activated
+		changed = true
+	}
+	if input.Disabled != nil && *input.Disabled != user.Disabled() {
+		user.DisabledAt = nil
+		if *input.Disabled {
+			now := time.Now()
+			user.DisabledAt = &now
+		}
+		changed = true
+	}
+	if !changed {
+		app.writeProfile(w, r, user)
+		return
+	}
+	err = app.models.Users.Update(user)
+	if err != nil {
+		app.dataErrorResponse(w, r, err)
+		return
+	}
+	if !user.Activated || user.Disabled() {
+		for _, scope := range []string{data.ScopeAuthentication, data.ScopeRefresh} {
+			err = app.models.Tokens.DeleteAllForUser(scope, user.ID)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+	}
+	app.revokeUserSessions(user.ID)
+	app.logger.PrintInfo("user updated by admin", map[string]string{
+		"admin_id":  strconv.FormatInt(app.contextGetUser(r).ID, 10),
+		"user_id":   strconv.FormatInt(user.ID, 10),
+		"activated": strconv.FormatBool(user.Activated),
+		"disabled":  strconv.FormatBool(user.Disabled()),
+	})
+	app.writeProfile(w, r, user)
+}
+
+func (app *application) resetUserPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUser(w, r)
+	if !ok {
+		return
+	}
+	randomBytes := make([]byte, 32)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = user.Password.Set(hex.EncodeToString(randomBytes))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.models.Users.Update(user)
+	if err != nil {
+		app.dataErrorResponse(w, r, err)
+		return
+	}
+	for _, scope := range []string{data.ScopeAuthentication, data.ScopeRefresh, data.ScopePasswordReset, data.ScopeEmailChange} {
+		err = app.models.Tokens.DeleteAllForUser(scope, user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	app.revokeUserSessions(user.ID)
+	token, err := app.models.Tokens.New(user.ID, 45*time.Minute, data.ScopePasswordReset)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.background(func() {
+		data := map[string]interface{}{
+			"passwordResetToken": token.Plaintext,
+		}
+		err := app.mailer.Send(user.Email, "password_reset.tmpl", data)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+	app.logger.PrintInfo("password reset forced by admin", map[string]string{
+		"admin_id": strconv.FormatInt(app.contextGetUser(r).ID, 10),
+		"user_id":  strconv.FormatInt(user.ID, 10),
+	})
+	env := envelope{"message": "the user's password was invalidated and reset instructions were emailed to them"}
+	err = app.writeResponse(w, r, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+type grantPermissionsInput struct {
+	Codes []string `json:"codes"`
+}
+
+func (app *application) grantPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUser(w, r)
+	if !ok {
+		return
+	}
+	var input grantPermissionsInput
+	err := app.decodeRequest(w, r, &input)
+	if err != nil {
+		app.decodeErrorResponse(w, r, err)
+		return
+	}
+	known, err := app.models.Permissions.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	v.Check(len(input.Codes) > 0, "codes", "must contain at least 1 permission code")
+	for i, code := range input.Codes {
+		v.Check(known.Include(code), fmt.Sprintf("codes.%d", i), "unknown permission code")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Permissions.AddForUser(user.ID, input.Codes...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.revokeUserSessions(user.ID)
+	app.logPermissionChange(r, "permissions granted by admin", user.ID, input.Codes)
+	app.writeProfile(w, r, user)
+}
+
+func (app *application) revokePermissionHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUser(w, r)
+	if !ok {
+		return
+	}
+	code := httprouter.ParamsFromContext(r.Context()).ByName("code")
+	err := app.models.Permissions.RemoveForUser(user.ID, code)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.revokeUserSessions(user.ID)
+	app.logPermissionChange(r, "permission revoked by admin", user.ID, []string{code})
+	app.writeProfile(w, r, user)
+}
+
+func (app *application) logPermissionChange(r *http.Request, message string, userID int64, codes []string) {
+	app.logger.PrintInfo(message, map[string]string{
+		"admin_id":    strconv.FormatInt(app.contextGetUser(r).ID, 10),
+		"user_id":     strconv.FormatInt(userID, 10),
+		"permissions": strings.Join(codes, ","),
+	})
+}
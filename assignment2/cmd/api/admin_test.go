@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestDisableUser(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app)
+	admin := insertTestUser(t, app, "admin@example.com")
+	err := app.models.Permissions.AddForUser(admin.ID, "users:admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := insertTestUser(t, app, "alice@example.com")
+	adminToken, _ := ts.login(t, "admin@example.com", testPassword)
+	access, refresh := ts.login(t, "alice@example.com", testPassword)
+	path := fmt.Sprintf("/v1/admin/users/%d", user.ID)
+
+	status, env := ts.do(t, http.MethodPatch, path, adminToken, envelope{"disabled": true})
+	if status != http.StatusOK {
+		t.Fatalf("disable: got status %d; want %d: %v", status, http.StatusOK, env)
+	}
+	status, _ = ts.do(t, http.MethodGet, "/v1/users/me", access, nil)
+	if status != http.StatusUnauthorized {
+		t.Errorf("session after disable: got status %d; want %d", status, http.StatusUnauthorized)
+	}
+	status, _ = ts.do(t, http.MethodPost, "/v1/tokens/refresh", "", envelope{"refresh_token": refresh})
+	if status != http.StatusUnprocessableEntity {
+		t.Errorf("refresh after disable: got status %d; want %d", status, http.StatusUnprocessableEntity)
+	}
+	status, env = ts.do(t, http.MethodPost, "/v1/tokens/authentication", "", envelope{"email": "alice@example.com", "password": testPassword})
+	if status != http.StatusForbidden || env["code"] != "account_disabled" {
+		t.Errorf("login after disable: got status %d code %v; want %d account_disabled", status, env["code"], http.StatusForbidden)
+	}
+
+	status, _ = ts.do(t, http.MethodPatch, path, adminToken, envelope{"disabled": false})
+	if status != http.StatusOK {
+		t.Fatalf("enable: got status %d; want %d", status, http.StatusOK)
+	}
+	ts.login(t, "alice@example.com", testPassword)
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.assignment2.com/internal/data"
+	"golang.assignment2.com/internal/patch"
+	"golang.assignment2.com/internal/validator"
+)
+
+const maxBatchOperations = 100
+
+type batchOperation struct {
+	Method   string          `json:"method"`
+	Resource string          `json:"resource"`
+	ID       int64           `json:"id,omitempty"`
+	Body     json.RawMessage `json:"body,omitempty"`
+}
+
+type batchInput struct {
+	Operations      []batchOperation `json:"operations"`
+	ContinueOnError bool             `json:"continue_on_error"`
+}
+
+type batchResult struct {
+	Index  int         `json:"index"`
+	Status int         `json:"status"`
+	Result interface{} `json:"result,omitempty"`
+	Error  *problem    `json:"error,omitempty"`
+}
+
+type batchContext struct {
+	r      *http.Request
+	models data.Models
+	user   *data.User
+	events []pendingEvent
+}
+
+type batchHandler func(bc *batchContext, op batchOperation) (int, interface{}, *problem, error)
+
+type batchResource struct {
+	permission string
+	handlers   map[string]batchHandler
+}
+
+func (app *application) batchResources() map[string]batchResource {
+	return map[string]batchResource{
+		"plantseed": {
+			permission: "plantseed:write",
+			handlers: map[string]batchHandler{
+				"create": app.batchCreatePlantseed,
+				"update": app.batchUpdatePlantseed,
+				"delete": app.batchDeletePlantseed,
+			},
+		},
+		"saved_search": {
+			handlers: map[string]batchHandler{
+				"create": app.batchCreateSavedSearch,
+				"delete": app.batchDeleteSavedSearch,
+			},
+		},
+	}
+}
+
+func (app *application) batchHandler(w http.ResponseWriter, r *http.Request) {
+	var input batchInput
+	err := app.decodeRequest(w, r, &input)
+	if err != nil {
+		app.decodeErrorResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	v.Check(len(input.Operations) > 0, "operations", "must contain at least 1 operation")
+	v.Check(len(input.Operations) <= maxBatchOperations, "operations", fmt.Sprintf("must not contain more than %d operations", maxBatchOperations))
+	resources := app.batchResources()
+	for i, op := range input.Operations {
+		resource, ok := resources[op.Resource]
+		if !ok {
+			v.AddError(fmt.Sprintf("operations[%d].resource", i), "unsupported resource")
+			continue
+		}
+		if _, ok := resource.handlers[op.Method]; !ok {
+			v.AddError(fmt.Sprintf("operations[%d].method", i), "unsupported method for this resource")
+		}
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user := app.contextGetUser(r)
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+	tx, models, err := app.models.BeginTx(ctx)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	defer tx.Rollback()
+	bc := &batchContext{r: r, models: models, user: user}
+	results := make([]batchResult, len(input.Operations))
+	failed := false
+	for i, op := range input.Operations {
+		results[i].Index = i
+		if failed && !input.ContinueOnError {
+			p := app.newProblem(r, http.StatusFailedDependency, "batch_aborted", "Batch Aborted", "the operation was not attempted because an earlier operation failed", nil)
+			results[i].Status = p.Status
+			results[i].Error = &p
+			continue
+		}
+		resource := resources[op.Resource]
+		if resource.permission != "" && !permissions.Include(resource.permission) {
+			p := app.newProblem(r, http.StatusForbidden, "not_permitted", "Not Permitted", "your user account doesn't have the necessary permissions to access this resource", nil)
+			results[i].Status = p.Status
+			results[i].Error = &p
+			failed = true
+			continue
+		}
+		if input.ContinueOnError {
+			_, err = tx.ExecContext(ctx, "SAVEPOINT batch_operation")
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+		pending := len(bc.events)
+		status, result, p, err := resource.handlers[op.Method](bc, op)
+		if err != nil {
+			if !input.ContinueOnError {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			app.logError(r, err)
+			serverError := app.newProblem(r, http.StatusInternalServerError, "server_error", "Internal Server Error", "the server encountered a problem and could not process this operation", nil)
+			status, p = serverError.Status, &serverError
+		}
+		results[i].Status = status
+		if p != nil {
+			results[i].Error = p
+			failed = true
+			if input.ContinueOnError {
+				bc.events = bc.events[:pending]
+				_, err = tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT batch_operation")
+			}
+		} else {
+			results[i].Result = result
+			if input.ContinueOnError {
+				_, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT batch_operation")
+			}
+		}
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	committed := !failed || input.ContinueOnError
+	if committed {
+		recorded, err := app.recordEvents(bc.models, bc.events...)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		err = tx.Commit()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		app.publishEvents(recorded...)
+	}
+	status := http.StatusOK
+	if !committed {
+		status = http.StatusUnprocessableEntity
+	}
+	err = app.writeResponse(w, r, status, envelope{"committed": committed, "results": results}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) batchDecode(bc *batchContext, body json.RawMessage, dst interface{}) *problem {
+	if len(body) == 0 {
+		body = json.RawMessage("{}")
+	}
+	err := decodeJSON(bytes.NewReader(body), dst, defaultMaxBodyBytes)
+	if err != nil {
+		p := app.newProblem(bc.r, http.StatusBadRequest, "bad_request", "Bad Request", err.Error(), nil)
+		return &p
+	}
+	return nil
+}
+
+func (app *application) batchValidationProblem(bc *batchContext, v *validator.Validator) *problem {
+	p := app.newProblem(bc.r, http.StatusUnprocessableEntity, "validation_failed", "Validation Failed", "the request contains invalid data", v.Errors)
+	return &p
+}
+
+func (app *application) batchDataError(bc *batchContext, err error) (int, interface{}, *problem, error) {
+	p, ok := app.dataErrorProblem(bc.r, err)
+	if !ok {
+		return 0, nil, nil, err
+	}
+	return p.Status, nil, &p, nil
+}
+
+func (app *application) batchCreatePlantseed(bc *batchContext, op batchOperation) (int, interface{}, *problem, error) {
+	var input plantseedDocument
+	if p := app.batchDecode(bc, op.Body, &input); p != nil {
+		return p.Status, nil, p, nil
+	}
+	if input.Language == "" {
+		input.Language = app.config.search.language
+	}
+	plantseed := &data.Plantseed{
+		Name:     input.Name,
+		Family:   input.Family,
+		Amount:   input.Amount,
+		Price:    input.Price,
+		Language: input.Language,
+	}
+	v := validator.New()
+	if data.ValidateMovie(v, plantseed); !v.Valid() {
+		p := app.batchValidationProblem(bc, v)
+		return p.Status, nil, p, nil
+	}
+	err := bc.models.Plantseed.Insert(plantseed)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	bc.events = append(bc.events, pendingEvent{eventType: eventPlantseedCreated, data: plantseed})
+	return http.StatusCreated, envelope{"plantseed": plantseed}, nil, nil
+}
+
+func (app *application) batchUpdatePlantseed(bc *batchContext, op batchOperation) (int, interface{}, *problem, error) {
+	plantseed, err := bc.models.Plantseed.Get(op.ID)
+	if err != nil {
+		return app.batchDataError(bc, err)
+	}
+	previousAmount := plantseed.Amount
+	current, err := json.Marshal(plantseedDocument{
+		Name:     plantseed.Name,
+		Family:   plantseed.Family,
+		Amount:   plantseed.Amount,
+		Price:    plantseed.Price,
+		Language: plantseed.Language,
+	})
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	if len(op.Body) == 0 {
+		op.Body = json.RawMessage("{}")
+	}
+	patched, err := patch.MergePatch(current, op.Body)
+	if err != nil {
+		p := app.newProblem(bc.r, http.StatusBadRequest, "bad_request", "Bad Request", err.Error(), nil)
+		return p.Status, nil, &p, nil
+	}
+	var input plantseedDocument
+	if p := app.batchDecode(bc, patched, &input); p != nil {
+		return p.Status, nil, p, nil
+	}
+	plantseed.Name = input.Name
+	plantseed.Family = input.Family
+	plantseed.Amount = input.Amount
+	plantseed.Price = input.Price
+	plantseed.Language = input.Language
+	v := validator.New()
+	if data.ValidateMovie(v, plantseed); !v.Valid() {
+		p := app.batchValidationProblem(bc, v)
+		return p.Status, nil, p, nil
+	}
+	err = bc.models.Plantseed.Update(plantseed)
+	if err != nil {
+		return app.batchDataError(bc, err)
+	}
+	bc.events = append(bc.events, plantseedUpdateEvents(previousAmount, plantseed)...)
+	return http.StatusOK, envelope{"plantseed": plantseed}, nil, nil
+}
+
+func (app *application) batchDeletePlantseed(bc *batchContext, op batchOperation) (int, interface{}, *problem, error) {
+	err := bc.models.Plantseed.Delete(op.ID)
+	if err != nil {
+		return app.batchDataError(bc, err)
+	}
+	bc.events = append(bc.events, pendingEvent{eventType: eventPlantseedDeleted, data: envelope{"id": op.ID}})
+	return http.StatusOK, envelope{"message": "plantseed successfully deleted"}, nil, nil
+}
+
+func (app *application) batchCreateSavedSearch(bc *batchContext, op batchOperation) (int, interface{}, *problem, error) {
+	var input createSavedSearchInput
+	if p := app.batchDecode(bc, op.Body, &input); p != nil {
+		return p.Status, nil, p, nil
+	}
+	v := validator.New()
+	search := app.newSavedSearch(v, bc.user.ID, input.Name, input.Query)
+	if !v.Valid() {
+		p := app.batchValidationProblem(bc, v)
+		return p.Status, nil, p, nil
+	}
+	count, err := bc.models.SavedSearches.CountForUser(bc.user.ID)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	if count >= data.MaxSavedSearchesPerUser {
+		v.AddError("name", "maximum number of saved searches reached")
+		p := app.batchValidationProblem(bc, v)
+		return p.Status, nil, p, nil
+	}
+	err = bc.models.SavedSearches.Insert(search)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	return http.StatusCreated, envelope{"saved_search": search}, nil, nil
+}
+
+func (app *application) batchDeleteSavedSearch(bc *batchContext, op batchOperation) (int, interface{}, *problem, error) {
+	err := bc.models.SavedSearches.Delete(op.ID, bc.user.ID)
+	if err != nil {
+		return app.batchDataError(bc, err)
+	}
+	return http.StatusOK, envelope{"message": "saved search successfully deleted"}, nil, nil
+}
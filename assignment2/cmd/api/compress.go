@@ -0,0 +1,173 @@
+package main
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const compressMinSize = 1024
+
+var compressibleTypes = []string{
+	"application/json",
+	"application/problem+json",
+	"application/xml",
+	"application/javascript",
+	"image/svg+xml",
+}
+
+func isCompressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case mediaType == "text/event-stream":
+		return false
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	case strings.HasSuffix(mediaType, "+json"), strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	for _, t := range compressibleTypes {
+		if mediaType == t {
+			return true
+		}
+	}
+	return false
+}
+
+func negotiateContentEncoding(header string) string {
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		if coding == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				value, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64)
+				if err == nil {
+					q = value
+				}
+			}
+		}
+		qualities[coding] = q
+	}
+	quality := func(coding string) float64 {
+		if q, ok := qualities[coding]; ok {
+			return q
+		}
+		return qualities["*"]
+	}
+	gzipQ, deflateQ := quality("gzip"), quality("deflate")
+	switch {
+	case gzipQ > 0 && gzipQ >= deflateQ:
+		return "gzip"
+	case deflateQ > 0:
+		return "deflate"
+	}
+	return ""
+}
+
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	status   int
+	buf      []byte
+	decided  bool
+	writer   io.WriteCloser
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.status == 0 {
+		cw.status = status
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if cw.decided {
+		if cw.writer != nil {
+			return cw.writer.Write(b)
+		}
+		return cw.ResponseWriter.Write(b)
+	}
+	cw.buf = append(cw.buf, b...)
+	if len(cw.buf) >= compressMinSize {
+		if err := cw.decide(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (cw *compressWriter) decide() error {
+	cw.decided = true
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	h := cw.Header()
+	bodyAllowed := cw.status >= 200 && cw.status != http.StatusNoContent && cw.status != http.StatusNotModified
+	if bodyAllowed && len(cw.buf) >= compressMinSize && h.Get("Content-Encoding") == "" && isCompressible(h.Get("Content-Type")) {
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+		switch cw.encoding {
+		case "gzip":
+			cw.writer = gzip.NewWriter(cw.ResponseWriter)
+		case "deflate":
+			cw.writer = zlib.NewWriter(cw.ResponseWriter)
+		}
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+	if len(cw.buf) == 0 {
+		return nil
+	}
+	var err error
+	if cw.writer != nil {
+		_, err = cw.writer.Write(cw.buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(cw.buf)
+	}
+	cw.buf = nil
+	return err
+}
+
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		if err := cw.decide(); err != nil {
+			return
+		}
+	}
+	if flusher, ok := cw.writer.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (cw *compressWriter) Close() error {
+	if !cw.decided && cw.status != 0 {
+		if err := cw.decide(); err != nil {
+			return err
+		}
+	}
+	if cw.writer != nil {
+		return cw.writer.Close()
+	}
+	return nil
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
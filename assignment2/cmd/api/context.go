@@ -9,7 +9,13 @@ import (
 
 type contextKey string
 
-const userContextKey = contextKey("user")
+const (
+	userContextKey      = contextKey("user")
+	encoderContextKey   = contextKey("encoder")
+	requestIDContextKey = contextKey("request_id")
+	routeContextKey     = contextKey("route")
+	sessionContextKey   = contextKey("session")
+)
 
 func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
 	ctx := context.WithValue(r.Context(), userContextKey, user)
@@ -23,3 +29,49 @@ func (app *application) contextGetUser(r *http.Request) *data.User {
 	}
 	return user
 }
+
+func (app *application) contextSetEncoder(r *http.Request, enc *responseEncoder) *http.Request {
+	ctx := context.WithValue(r.Context(), encoderContextKey, enc)
+	return r.WithContext(ctx)
+}
+
+func (app *application) contextGetEncoder(r *http.Request) *responseEncoder {
+	enc, ok := r.Context().Value(encoderContextKey).(*responseEncoder)
+	if !ok {
+		return jsonEncoder
+	}
+	return enc
+}
+
+func (app *application) contextSetRequestID(r *http.Request, id string) *http.Request {
+	ctx := context.WithValue(r.Context(), requestIDContextKey, id)
+	return r.WithContext(ctx)
+}
+
+func (app *application) contextGetRequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey).(string)
+	return id
+}
+
+func (app *application) contextSetRoute(r *http.Request, rt *route) *http.Request {
+	ctx := context.WithValue(r.Context(), routeContextKey, rt)
+	return r.WithContext(ctx)
+}
+
+func (app *application) contextGetRoute(r *http.Request) *route {
+	rt, _ := r.Context().Value(routeContextKey).(*route)
+	return rt
+}
+
+func (app *application) contextSetSession(r *http.Request, session *authSession) *http.Request {
+	ctx := context.WithValue(r.Context(), sessionContextKey, session)
+	return r.WithContext(ctx)
+}
+
+func (app *application) contextGetSession(r *http.Request) *authSession {
+	session, ok := r.Context().Value(sessionContextKey).(*authSession)
+	if !ok {
+		return &authSession{}
+	}
+	return session
+}
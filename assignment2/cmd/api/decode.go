@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"golang.assignment2.com/internal/validator"
+)
+
+const (
+	defaultMaxBodyBytes = 1_048_576
+	mediaTypeJSON       = "application/json"
+	mediaTypeForm       = "application/x-www-form-urlencoded"
+	mediaTypeMultipart  = "multipart/form-data"
+)
+
+var defaultContentTypes = []string{mediaTypeJSON, mediaTypeForm, mediaTypeMultipart}
+
+type unsupportedMediaTypeError struct {
+	supported []string
+}
+
+func (e *unsupportedMediaTypeError) Error() string {
+	return fmt.Sprintf("body content type is not supported, supported types are: %s", strings.Join(e.supported, ", "))
+}
+
+func (rt *route) bodyLimit() int {
+	if rt == nil || rt.maxBytes == 0 {
+		return defaultMaxBodyBytes
+	}
+	return rt.maxBytes
+}
+
+func (rt *route) acceptedContentTypes() []string {
+	if rt == nil || len(rt.contentTypes) == 0 {
+		return defaultContentTypes
+	}
+	return rt.contentTypes
+}
+
+func (app *application) decodeRequest(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	rt := app.contextGetRoute(r)
+	maxBytes := rt.bodyLimit()
+	supported := rt.acceptedContentTypes()
+	mediaType := requestMediaType(r)
+	if mediaType == "" {
+		mediaType = mediaTypeJSON
+	}
+	if !validator.In(mediaType, supported...) {
+		return &unsupportedMediaTypeError{supported: supported}
+	}
+	err := app.limitBody(w, r, maxBytes)
+	if err != nil {
+		return err
+	}
+	switch mediaType {
+	case mediaTypeJSON:
+		return decodeJSON(r.Body, dst, maxBytes)
+	case mediaTypeForm:
+		err = r.ParseForm()
+		if err != nil {
+			return formError(err, maxBytes)
+		}
+		return decodeForm(r.PostForm, dst, maxBytes)
+	case mediaTypeMultipart:
+		err = r.ParseMultipartForm(int64(maxBytes))
+		if err != nil {
+			return formError(err, maxBytes)
+		}
+		defer r.MultipartForm.RemoveAll()
+		for key := range r.MultipartForm.File {
+			return fmt.Errorf("body contains unexpected file for key %q", key)
+		}
+		return decodeForm(r.MultipartForm.Value, dst, maxBytes)
+	default:
+		return &unsupportedMediaTypeError{supported: supported}
+	}
+}
+
+func formError(err error, maxBytes int) error {
+	var maxBytesError *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesError):
+		return fmt.Errorf("body must not be larger than %d bytes", maxBytes)
+	case errors.Is(err, http.ErrMissingBoundary), errors.Is(err, http.ErrNotMultipart):
+		return errors.New("body contains badly-formed multipart data")
+	default:
+		return fmt.Errorf("body contains badly-formed form data: %w", err)
+	}
+}
+
+func decodeForm(values url.Values, dst interface{}, maxBytes int) error {
+	if len(values) == 0 {
+		return errors.New("body must not be empty")
+	}
+	fields := jsonFields(reflect.TypeOf(dst).Elem())
+	doc := make(map[string]interface{}, len(values))
+	for key, vals := range values {
+		t, ok := fields[strings.ToLower(key)]
+		if !ok {
+			doc[key] = vals[0]
+			continue
+		}
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		if t.Kind() == reflect.Slice {
+			items := make([]interface{}, 0, len(vals))
+			for _, s := range vals {
+				if s != "" {
+					items = append(items, formValue(t.Elem(), s))
+				}
+			}
+			doc[key] = items
+			continue
+		}
+		if len(vals) > 1 {
+			return fmt.Errorf("body contains multiple values for key %q", key)
+		}
+		if vals[0] == "" && t.Kind() != reflect.String {
+			continue
+		}
+		doc[key] = formValue(t, vals[0])
+	}
+	js, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return decodeJSON(bytes.NewReader(js), dst, maxBytes)
+}
+
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	if t.Kind() != reflect.Struct {
+		return fields
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[strings.ToLower(name)] = field.Type
+	}
+	return fields
+}
+
+func formValue(t reflect.Type, s string) interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return s
+	case reflect.Bool:
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		var n float64
+		if json.Unmarshal([]byte(s), &n) == nil {
+			return json.Number(s)
+		}
+	case reflect.Map, reflect.Struct, reflect.Slice, reflect.Interface:
+		if json.Valid([]byte(s)) {
+			return json.RawMessage(s)
+		}
+	}
+	return s
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.assignment2.com/internal/jsonlog"
+)
+
+type decodeTestInput struct {
+	Name   string   `json:"name"`
+	Amount *int     `json:"amount"`
+	Tags   []string `json:"tags"`
+}
+
+func newDecodeRequest(t *testing.T, rt *route, contentType string, body string) *http.Request {
+	t.Helper()
+	app := &application{}
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	return app.contextSetRoute(r, rt)
+}
+
+func TestDecodeRequest(t *testing.T) {
+	jsonOnly := &route{contentTypes: []string{mediaTypeJSON}, maxBytes: 64}
+	tests := []struct {
+		name        string
+		rt          *route
+		contentType string
+		body        string
+		want        decodeTestInput
+		wantErr     string
+		mediaType   bool
+	}{
+		{
+			name:        "json",
+			contentType: "application/json; charset=utf-8",
+			body:        `{"name":"rose","amount":3,"tags":["red"]}`,
+			want:        decodeTestInput{Name: "rose", Amount: intPtr(3), Tags: []string{"red"}},
+		},
+		{
+			name: "missing content type is json",
+			body: `{"name":"rose"}`,
+			want: decodeTestInput{Name: "rose"},
+		},
+		{
+			name:        "form",
+			contentType: mediaTypeForm,
+			body:        "name=rose&amount=3&tags=red&tags=white",
+			want:        decodeTestInput{Name: "rose", Amount: intPtr(3), Tags: []string{"red", "white"}},
+		},
+		{
+			name:        "form with invalid number",
+			contentType: mediaTypeForm,
+			body:        "amount=three",
+			wantErr:     "amount",
+		},
+		{
+			name:        "form with repeated scalar",
+			contentType: mediaTypeForm,
+			body:        "name=rose&name=tulip",
+			wantErr:     "multiple values",
+		},
+		{
+			name:        "unknown json field",
+			contentType: mediaTypeJSON,
+			body:        `{"colour":"red"}`,
+			wantErr:     "unknown key",
+		},
+		{
+			name:        "unsupported content type",
+			contentType: "text/plain",
+			body:        "rose",
+			mediaType:   true,
+		},
+		{
+			name:        "content type not accepted by route",
+			rt:          jsonOnly,
+			contentType: mediaTypeForm,
+			body:        "name=rose",
+			mediaType:   true,
+		},
+		{
+			name:        "body too large",
+			rt:          jsonOnly,
+			contentType: mediaTypeJSON,
+			body:        `{"name":"` + strings.Repeat("a", 100) + `"}`,
+			wantErr:     "must not be larger than 64 bytes",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &application{}
+			r := newDecodeRequest(t, tt.rt, tt.contentType, tt.body)
+			var input decodeTestInput
+			err := app.decodeRequest(httptest.NewRecorder(), r, &input)
+			var mediaTypeErr *unsupportedMediaTypeError
+			switch {
+			case tt.mediaType:
+				if !errors.As(err, &mediaTypeErr) {
+					t.Fatalf("got error %v; want unsupported media type", err)
+				}
+			case tt.wantErr != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v; want error containing %q", err, tt.wantErr)
+				}
+			case err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			default:
+				if input.Name != tt.want.Name || !equalIntPtr(input.Amount, tt.want.Amount) || strings.Join(input.Tags, ",") != strings.Join(tt.want.Tags, ",") {
+					t.Errorf("got %+v; want %+v", input, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeRequestRejectsFiles(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("name", "rose")
+	fw, err := mw.CreateFormFile("photo", "rose.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write([]byte("jpeg"))
+	mw.Close()
+	app := &application{}
+	r := newDecodeRequest(t, nil, mw.FormDataContentType(), body.String())
+	var input decodeTestInput
+	err = app.decodeRequest(httptest.NewRecorder(), r, &input)
+	if err == nil || !strings.Contains(err.Error(), "unexpected file") {
+		t.Fatalf("got error %v; want unexpected file error", err)
+	}
+}
+
+func TestDecodeErrorResponseUnsupportedMediaType(t *testing.T) {
+	app := &application{logger: jsonlog.New(&bytes.Buffer{}, jsonlog.LevelInfo)}
+	r := newDecodeRequest(t, nil, "text/plain", "rose")
+	var input decodeTestInput
+	err := app.decodeRequest(httptest.NewRecorder(), r, &input)
+	rr := httptest.NewRecorder()
+	app.decodeErrorResponse(rr, r, err)
+	if rr.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("got status %d; want %d", rr.Code, http.StatusUnsupportedMediaType)
+	}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func equalIntPtr(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type responseEncoder struct {
+	format             string
+	mediaType          string
+	contentType        string
+	problemContentType string
+	encode             func(w io.Writer, data interface{}) error
+}
+
+var (
+	jsonEncoder = &responseEncoder{
+		format:             "json",
+		mediaType:          "application/json",
+		contentType:        "application/json",
+		problemContentType: "application/problem+json",
+		encode:             encodeJSON,
+	}
+	compactJSONEncoder = &responseEncoder{
+		format:             "compact",
+		mediaType:          "application/json",
+		contentType:        "application/json",
+		problemContentType: "application/problem+json",
+		encode:             encodeCompactJSON,
+	}
+	csvEncoder = &responseEncoder{
+		format:             "csv",
+		mediaType:          "text/csv",
+		contentType:        "text/csv; charset=utf-8",
+		problemContentType: "text/csv; charset=utf-8",
+		encode:             encodeCSV,
+	}
+	xmlEncoder = &responseEncoder{
+		format:             "xml",
+		mediaType:          "application/xml",
+		contentType:        "application/xml; charset=utf-8",
+		problemContentType: "application/problem+xml; charset=utf-8",
+		encode:             encodeXML,
+	}
+)
+
+var responseEncoders = []*responseEncoder{jsonEncoder, compactJSONEncoder, csvEncoder, xmlEncoder}
+
+type acceptRange struct {
+	mediaType string
+	params    map[string]string
+	q         float64
+}
+
+func parseAccept(header string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			delete(params, "q")
+		}
+		ranges = append(ranges, acceptRange{mediaType: mediaType, params: params, q: q})
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+	return ranges
+}
+
+func (ar acceptRange) encoder() *responseEncoder {
+	switch ar.mediaType {
+	case "*/*", "application/*", "text/event-stream":
+		return jsonEncoder
+	case "application/json":
+		if compact, _ := strconv.ParseBool(ar.params["compact"]); compact {
+			return compactJSONEncoder
+		}
+		return jsonEncoder
+	case "text/csv", "text/*":
+		return csvEncoder
+	case "application/xml", "text/xml":
+		return xmlEncoder
+	}
+	return nil
+}
+
+func negotiateEncoder(format, accept string) *responseEncoder {
+	if format != "" {
+		for _, enc := range responseEncoders {
+			if enc.format == format {
+				return enc
+			}
+		}
+		return nil
+	}
+	if strings.TrimSpace(accept) == "" {
+		return jsonEncoder
+	}
+	for _, ar := range parseAccept(accept) {
+		if ar.q <= 0 {
+			continue
+		}
+		if enc := ar.encoder(); enc != nil {
+			return enc
+		}
+	}
+	return nil
+}
+
+func encodeJSON(w io.Writer, data interface{}) error {
+	js, err := json.MarshalIndent(data, "", "\t")
+	if err != nil {
+		return err
+	}
+	js = append(js, '\n')
+	_, err = w.Write(js)
+	return err
+}
+
+func encodeCompactJSON(w io.Writer, data interface{}) error {
+	return json.NewEncoder(w).Encode(data)
+}
+
+func toGeneric(data interface{}) (interface{}, error) {
+	js, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+	var generic interface{}
+	err = dec.Decode(&generic)
+	return generic, err
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func tabulate(generic interface{}) []map[string]interface{} {
+	m, ok := generic.(map[string]interface{})
+	if !ok {
+		return []map[string]interface{}{{"value": generic}}
+	}
+	keys := sortedKeys(m)
+	for _, key := range keys {
+		if list, ok := m[key].([]interface{}); ok {
+			records := make([]map[string]interface{}, len(list))
+			for i, item := range list {
+				if record, ok := item.(map[string]interface{}); ok {
+					records[i] = record
+				} else {
+					records[i] = map[string]interface{}{"value": item}
+				}
+			}
+			return records
+		}
+	}
+	if len(keys) == 1 {
+		if record, ok := m[keys[0]].(map[string]interface{}); ok {
+			return []map[string]interface{}{record}
+		}
+	}
+	return []map[string]interface{}{m}
+}
+
+func csvCell(value interface{}) (string, error) {
+	switch value := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return value, nil
+	case json.Number:
+		return value.String(), nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	default:
+		js, err := json.Marshal(value)
+		return string(js), err
+	}
+}
+
+func encodeCSV(w io.Writer, data interface{}) error {
+	generic, err := toGeneric(data)
+	if err != nil {
+		return err
+	}
+	records := tabulate(generic)
+	seen := make(map[string]bool)
+	var columns []string
+	for _, record := range records {
+		for _, key := range sortedKeys(record) {
+			if !seen[key] {
+				seen[key] = true
+				columns = append(columns, key)
+			}
+		}
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+	for _, record := range records {
+		row := make([]string, len(columns))
+		for i, column := range columns {
+			row[i], err = csvCell(record[column])
+			if err != nil {
+				return err
+			}
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func xmlName(key string) string {
+	var sb strings.Builder
+	for i, r := range key {
+		switch {
+		case unicode.IsLetter(r) || r == '_':
+			sb.WriteRune(r)
+		case i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.'):
+			sb.WriteRune(r)
+		default:
+			sb.WriteRune('_')
+		}
+	}
+	if sb.Len() == 0 {
+		return "_"
+	}
+	return sb.String()
+}
+
+func writeXMLValue(enc *xml.Encoder, name string, value interface{}) error {
+	start := xml.StartElement{Name: xml.Name{Local: xmlName(name)}}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for _, key := range sortedKeys(value) {
+			if err := writeXMLValue(enc, key, value[key]); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range value {
+			if err := writeXMLValue(enc, "item", item); err != nil {
+				return err
+			}
+		}
+	case nil:
+	default:
+		text, err := csvCell(value)
+		if err != nil {
+			return err
+		}
+		if err := enc.EncodeToken(xml.CharData(text)); err != nil {
+			return err
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+func encodeXML(w io.Writer, data interface{}) error {
+	generic, err := toGeneric(data)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+	if err := writeXMLValue(enc, "response", generic); err != nil {
+		return err
+	}
+	if err := enc.Flush(); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
@@ -1,20 +1,119 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.assignment2.com/internal/data"
+	"golang.assignment2.com/internal/patch"
 )
 
+type problem struct {
+	Type     string            `json:"type"`
+	Code     string            `json:"code"`
+	Title    string            `json:"title"`
+	Status   int               `json:"status"`
+	Detail   string            `json:"detail,omitempty"`
+	Instance string            `json:"instance,omitempty"`
+	Errors   map[string]string `json:"errors,omitempty"`
+}
+
+type dataErrorProblem struct {
+	err    error
+	status int
+	code   string
+	title  string
+	detail string
+	field  string
+}
+
+var dataErrorProblems = []dataErrorProblem{
+	{
+		err:    data.ErrRecordNotFound,
+		status: http.StatusNotFound,
+		code:   "not_found",
+		title:  "Resource Not Found",
+		detail: "the requested resource could not be found",
+	},
+	{
+		err:    data.ErrEditConflict,
+		status: http.StatusConflict,
+		code:   "edit_conflict",
+		title:  "Edit Conflict",
+		detail: "unable to update the record due to an edit conflict, please try again",
+	},
+	{
+		err:    data.ErrDuplicateEmail,
+		status: http.StatusUnprocessableEntity,
+		code:   "duplicate_email",
+		title:  "Duplicate Email Address",
+		detail: "a user with this email address already exists",
+		field:  "email",
+	},
+}
+
 func (app *application) logError(r *http.Request, err error) {
 	app.logger.PrintError(err, map[string]string{
+		"request_id":     app.contextGetRequestID(r),
 		"request_method": r.Method,
 		"request_url":    r.URL.String(),
 	})
 }
 
-func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message interface{}) {
-	env := envelope{"error": message}
-	err := app.writeJSON(w, status, env, nil)
+func (app *application) problemType(code string) string {
+	base := app.config.problems.typeBase
+	if base == "" || base == "about:blank" {
+		return "about:blank"
+	}
+	return base + code
+}
+
+func (app *application) newProblem(r *http.Request, status int, code, title, detail string, errs map[string]string) problem {
+	return problem{
+		Type:     app.problemType(code),
+		Code:     code,
+		Title:    title,
+		Status:   status,
+		Detail:   detail,
+		Instance: app.contextGetRequestID(r),
+		Errors:   errs,
+	}
+}
+
+func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, code, title, detail string, errs map[string]string) {
+	p := app.newProblem(r, status, code, title, detail, errs)
+	err := app.writeProblem(w, r, p)
+	if err != nil {
+		app.logError(r, err)
+		w.WriteHeader(500)
+	}
+}
+
+func (app *application) dataErrorProblem(r *http.Request, err error) (problem, bool) {
+	for _, p := range dataErrorProblems {
+		if errors.Is(err, p.err) {
+			var errs map[string]string
+			if p.field != "" {
+				errs = map[string]string{p.field: p.detail}
+			}
+			return app.newProblem(r, p.status, p.code, p.title, p.detail, errs), true
+		}
+	}
+	return problem{}, false
+}
+
+func (app *application) dataErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	p, ok := app.dataErrorProblem(r, err)
+	if !ok {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeProblem(w, r, p)
 	if err != nil {
 		app.logError(r, err)
 		w.WriteHeader(500)
@@ -24,49 +123,99 @@ func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, st
 func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
 	app.logError(r, err)
 	message := "the server encountered a problem and could not process your request"
-	app.errorResponse(w, r, http.StatusInternalServerError, message)
+	app.errorResponse(w, r, http.StatusInternalServerError, "server_error", "Internal Server Error", message, nil)
 }
 func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request) {
-	message := "the requested resource could not be found"
-	app.errorResponse(w, r, http.StatusNotFound, message)
+	app.dataErrorResponse(w, r, data.ErrRecordNotFound)
 }
 
 func (app *application) methodNotAllowedResponse(w http.ResponseWriter, r *http.Request) {
 	message := fmt.Sprintf("the %s method is not supported for this resource", r.Method)
-	app.errorResponse(w, r, http.StatusMethodNotAllowed, message)
+	app.errorResponse(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "Method Not Allowed", message, nil)
 }
 func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
-	app.errorResponse(w, r, http.StatusBadRequest, err.Error())
+	app.errorResponse(w, r, http.StatusBadRequest, "bad_request", "Bad Request", err.Error(), nil)
 }
 func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
-	app.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
+	message := "the request contains invalid data"
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, "validation_failed", "Validation Failed", message, errors)
 }
 func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Request) {
-	message := "unable to update the record due to an edit conflict, please try again"
-	app.errorResponse(w, r, http.StatusConflict, message)
+	app.dataErrorResponse(w, r, data.ErrEditConflict)
 }
 func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
 	message := "rate limit exceeded"
-	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+	app.errorResponse(w, r, http.StatusTooManyRequests, "rate_limit_exceeded", "Rate Limit Exceeded", message, nil)
+}
+func (app *application) loginLockedResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	message := "too many failed login attempts, please retry later"
+	app.errorResponse(w, r, http.StatusTooManyRequests, "login_locked", "Too Many Login Attempts", message, nil)
 }
 func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
 	message := "invalid authentication credentials"
-	app.errorResponse(w, r, http.StatusUnauthorized, message)
+	app.errorResponse(w, r, http.StatusUnauthorized, "invalid_credentials", "Invalid Credentials", message, nil)
 }
 func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("WWW-Authenticate", "Bearer")
 	message := "invalid or missing authentication token"
-	app.errorResponse(w, r, http.StatusUnauthorized, message)
+	app.errorResponse(w, r, http.StatusUnauthorized, "invalid_authentication_token", "Invalid Authentication Token", message, nil)
 }
 func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
 	message := "you must be authenticated to access this resource"
-	app.errorResponse(w, r, http.StatusUnauthorized, message)
+	app.errorResponse(w, r, http.StatusUnauthorized, "authentication_required", "Authentication Required", message, nil)
 }
 func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.Request) {
 	message := "your user account must be activated to access this resource"
-	app.errorResponse(w, r, http.StatusForbidden, message)
+	app.errorResponse(w, r, http.StatusForbidden, "inactive_account", "Inactive Account", message, nil)
+}
+func (app *application) accountDisabledResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account has been disabled"
+	app.errorResponse(w, r, http.StatusForbidden, "account_disabled", "Account Disabled", message, nil)
 }
 func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
 	message := "your user account doesn't have the necessary permissions to access this resource"
-	app.errorResponse(w, r, http.StatusForbidden, message)
+	app.errorResponse(w, r, http.StatusForbidden, "not_permitted", "Not Permitted", message, nil)
+}
+func (app *application) notAcceptableResponse(w http.ResponseWriter, r *http.Request) {
+	formats := make([]string, len(responseEncoders))
+	for i, enc := range responseEncoders {
+		formats[i] = enc.format
+	}
+	message := fmt.Sprintf("unable to produce a response in the requested format, supported formats are: %s", strings.Join(formats, ", "))
+	app.errorResponse(w, r, http.StatusNotAcceptable, "not_acceptable", "Not Acceptable", message, nil)
+}
+func (app *application) idempotencyKeyReusedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the idempotency key has already been used for a different request"
+	app.errorResponse(w, r, http.StatusConflict, "idempotency_key_reused", "Idempotency Key Reused", message, nil)
+}
+func (app *application) idempotencyKeyInProgressResponse(w http.ResponseWriter, r *http.Request) {
+	message := "a request with this idempotency key is still being processed, please retry later"
+	app.errorResponse(w, r, http.StatusConflict, "idempotency_key_in_progress", "Idempotency Key In Progress", message, nil)
+}
+func (app *application) patchErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, patch.ErrTestFailed):
+		app.errorResponse(w, r, http.StatusConflict, "patch_test_failed", "Patch Test Failed", err.Error(), nil)
+	case errors.Is(err, patch.ErrInapplicablePatch):
+		app.errorResponse(w, r, http.StatusUnprocessableEntity, "patch_unprocessable", "Patch Cannot Be Applied", err.Error(), nil)
+	default:
+		app.badRequestResponse(w, r, err)
+	}
+}
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request, supported ...string) {
+	message := fmt.Sprintf("the %q content type is not supported for this resource, supported types are: %s", requestMediaType(r), strings.Join(supported, ", "))
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, "unsupported_media_type", "Unsupported Media Type", message, nil)
+}
+func (app *application) decodeErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	var mediaTypeErr *unsupportedMediaTypeError
+	if errors.As(err, &mediaTypeErr) {
+		app.unsupportedMediaTypeResponse(w, r, mediaTypeErr.supported...)
+		return
+	}
+	app.badRequestResponse(w, r, err)
+}
+func (app *application) serviceUnavailableResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the server is shutting down, please retry later"
+	app.errorResponse(w, r, http.StatusServiceUnavailable, "service_unavailable", "Service Unavailable", message, nil)
 }
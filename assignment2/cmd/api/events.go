@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.assignment2.com/internal/data"
+	"golang.assignment2.com/internal/events"
+)
+
+const (
+	eventPlantseedCreated      = "plantseed.created"
+	eventPlantseedUpdated      = "plantseed.updated"
+	eventPlantseedDeleted      = "plantseed.deleted"
+	eventPlantseedStockChanged = "plantseed.stock_changed"
+)
+
+var eventTypes = []string{
+	eventPlantseedCreated,
+	eventPlantseedUpdated,
+	eventPlantseedDeleted,
+	eventPlantseedStockChanged,
+}
+
+type pendingEvent struct {
+	eventType string
+	data      interface{}
+}
+
+func plantseedUpdateEvents(previousAmount int32, plantseed *data.Plantseed) []pendingEvent {
+	pending := []pendingEvent{{eventType: eventPlantseedUpdated, data: plantseed}}
+	if previousAmount != plantseed.Amount {
+		pending = append(pending, pendingEvent{
+			eventType: eventPlantseedStockChanged,
+			data:      envelope{"id": plantseed.ID, "previous_amount": previousAmount, "amount": plantseed.Amount},
+		})
+	}
+	return pending
+}
+
+func (app *application) recordEvents(models data.Models, pending ...pendingEvent) ([]events.Event, error) {
+	recorded := make([]events.Event, 0, len(pending))
+	for _, p := range pending {
+		id, err := models.Webhooks.NextEventID()
+		if err != nil {
+			return nil, err
+		}
+		event, err := events.NewEvent(id, p.eventType, p.data)
+		if err != nil {
+			return nil, err
+		}
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return nil, err
+		}
+		_, err = models.Webhooks.Enqueue(event.ID, event.Type, payload)
+		if err != nil {
+			return nil, err
+		}
+		recorded = append(recorded, event)
+	}
+	return recorded, nil
+}
+
+func (app *application) publishEvents(recorded ...events.Event) {
+	for _, event := range recorded {
+		app.events.Publish(event)
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event events.Event) error {
+	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data)
+	return err
+}
+
+func (app *application) streamEventsHandler(w http.ResponseWriter, r *http.Request) {
+	var lastEventID int64
+	if header := r.Header.Get("Last-Event-ID"); header != "" {
+		id, err := strconv.ParseInt(header, 10, 64)
+		if err != nil || id < 0 {
+			app.badRequestResponse(w, r, errors.New("Last-Event-ID header must be a non-negative integer"))
+			return
+		}
+		lastEventID = id
+	}
+	sub, err := app.events.Subscribe(lastEventID)
+	if err != nil {
+		app.serviceUnavailableResponse(w, r)
+		return
+	}
+	defer sub.Close()
+	rc := http.NewResponseController(w)
+	err = rc.SetWriteDeadline(time.Time{})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if !sub.Complete {
+		_, err = fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+		if err != nil {
+			return
+		}
+	}
+	for _, event := range sub.Backlog {
+		if writeEvent(w, event) != nil {
+			return
+		}
+	}
+	if rc.Flush() != nil {
+		return
+	}
+	ticker := time.NewTicker(app.config.events.heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.Events:
+			if !ok {
+				return
+			}
+			err = writeEvent(w, event)
+		case <-ticker.C:
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
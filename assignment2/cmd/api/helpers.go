@@ -1,48 +1,105 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
+	"golang.assignment2.com/internal/patch"
 	"golang.assignment2.com/internal/validator"
 )
 
 func (app *application) readIDParam(r *http.Request) (int64, error) {
+	return app.readInt64Param(r, "id")
+}
+
+func (app *application) readInt64Param(r *http.Request, name string) (int64, error) {
 	params := httprouter.ParamsFromContext(r.Context())
-	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
 	if err != nil || id < 1 {
-		return 0, errors.New("invalid id parameter")
+		return 0, fmt.Errorf("invalid %s parameter", name)
 	}
 	return id, nil
 }
 
 type envelope map[string]interface{}
 
-func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
-	js, err := json.MarshalIndent(data, "", "\t")
+func (app *application) writeResponse(w http.ResponseWriter, r *http.Request, status int, data envelope, headers http.Header) error {
+	enc := app.contextGetEncoder(r)
+	return app.writeEncoded(w, enc, enc.contentType, status, data, headers)
+}
+
+func (app *application) writeProblem(w http.ResponseWriter, r *http.Request, p problem) error {
+	enc := app.contextGetEncoder(r)
+	return app.writeEncoded(w, enc, enc.problemContentType, p.Status, p, nil)
+}
+
+func (app *application) writeEncoded(w http.ResponseWriter, enc *responseEncoder, contentType string, status int, data interface{}, headers http.Header) error {
+	var buf bytes.Buffer
+	err := enc.encode(&buf, data)
 	if err != nil {
 		return err
 	}
-	js = append(js, '\n')
 	for key, value := range headers {
 		w.Header()[key] = value
 	}
-	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Type", contentType)
 	w.WriteHeader(status)
-	w.Write(js)
+	w.Write(buf.Bytes())
 	return nil
 }
-func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
-	maxBytes := 1_048_576
+
+const (
+	mediaTypeMergePatch = "application/merge-patch+json"
+	mediaTypeJSONPatch  = "application/json-patch+json"
+)
+
+func clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+func requestMediaType(r *http.Request) string {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
+
+func (app *application) limitBody(w http.ResponseWriter, r *http.Request, maxBytes int) error {
 	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
-	dec := json.NewDecoder(r.Body)
+	switch strings.ToLower(r.Header.Get("Content-Encoding")) {
+	case "", "identity":
+	case "gzip":
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return errors.New("body contains badly-formed gzip data")
+		}
+		r.Body = http.MaxBytesReader(w, gz, int64(maxBytes))
+	default:
+		return fmt.Errorf("body has unsupported content encoding %q", r.Header.Get("Content-Encoding"))
+	}
+	return nil
+}
+
+func decodeJSON(body io.Reader, dst interface{}, maxBytes int) error {
+	dec := json.NewDecoder(body)
 	dec.DisallowUnknownFields()
 	err := dec.Decode(dst)
 	if err != nil {
@@ -52,6 +109,8 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst int
 		switch {
 		case errors.As(err, &syntaxError):
 			return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
+		case errors.Is(err, gzip.ErrChecksum), errors.Is(err, gzip.ErrHeader):
+			return errors.New("body contains badly-formed gzip data")
 		case errors.Is(err, io.ErrUnexpectedEOF):
 			return errors.New("body contains badly-formed JSON")
 		case errors.As(err, &unmarshalTypeError):
@@ -79,6 +138,41 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst int
 	return nil
 }
 
+func (app *application) readPatch(w http.ResponseWriter, r *http.Request, doc interface{}, dst interface{}) error {
+	maxBytes := app.contextGetRoute(r).bodyLimit()
+	err := app.limitBody(w, r, maxBytes)
+	if err != nil {
+		return err
+	}
+	patchDocument, err := io.ReadAll(r.Body)
+	if err != nil {
+		if err.Error() == "http: request body too large" {
+			return fmt.Errorf("body must not be larger than %d bytes", maxBytes)
+		}
+		return err
+	}
+	if len(bytes.TrimSpace(patchDocument)) == 0 {
+		return errors.New("body must not be empty")
+	}
+	current, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	var patched []byte
+	switch requestMediaType(r) {
+	case mediaTypeMergePatch:
+		patched, err = patch.MergePatch(current, patchDocument)
+	case mediaTypeJSONPatch:
+		patched, err = patch.Apply(current, patchDocument)
+	default:
+		return fmt.Errorf("unsupported patch media type %q", requestMediaType(r))
+	}
+	if err != nil {
+		return err
+	}
+	return decodeJSON(bytes.NewReader(patched), dst, maxBytes)
+}
+
 func (app *application) readString(qs url.Values, key string, defaultValue string) string {
 	s := qs.Get(key)
 	if s == "" {
@@ -87,13 +181,13 @@ func (app *application) readString(qs url.Values, key string, defaultValue strin
 	return s
 }
 
-// func (app *application) readCSV(qs url.Values, key string, defaultValue []string) []string {
-// 	csv := qs.Get(key)
-// 	if csv == "" {
-// 		return defaultValue
-// 	}
-// 	return strings.Split(csv, ",")
-// }
+func (app *application) readCSV(qs url.Values, key string, defaultValue []string) []string {
+	csv := qs.Get(key)
+	if csv == "" {
+		return defaultValue
+	}
+	return strings.Split(csv, ",")
+}
 
 func (app *application) readInt(qs url.Values, key string, defaultValue int, v *validator.Validator) int {
 	s := qs.Get(key)
@@ -120,3 +214,25 @@ func (app *application) background(fn func()) {
 		fn()
 	}()
 }
+
+func (app *application) runPeriodically(ctx context.Context, interval time.Duration, fn func()) {
+	app.background(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				func() {
+					defer func() {
+						if err := recover(); err != nil {
+							app.logger.PrintError(fmt.Errorf("%s", err), nil)
+						}
+					}()
+					fn()
+				}()
+			}
+		}
+	})
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.assignment2.com/internal/data"
+	"golang.assignment2.com/internal/jwt"
+)
+
+var errTokenRevoked = errors.New("token has been revoked")
+
+type authSession struct {
+	family int64
+	claims *jwt.Claims
+}
+
+func newJWTSigner(cfg config) (*jwt.Signer, error) {
+	keys := make(map[string][]byte)
+	active := cfg.jwt.activeKey
+	for _, field := range strings.Fields(cfg.jwt.keys) {
+		kid, encoded, ok := strings.Cut(field, "=")
+		if !ok || kid == "" {
+			return nil, fmt.Errorf("jwt key %q must have the form kid=base64", field)
+		}
+		material, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("jwt key %q is not valid base64", kid)
+		}
+		keys[kid] = material
+		if active == "" {
+			active = kid
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("jwt-keys must contain at least one key")
+	}
+	return jwt.NewSigner(cfg.jwt.algorithm, keys, active)
+}
+
+func (app *application) issueSession(models data.Models, r *http.Request, userID, family int64) (*data.Token, *data.Token, error) {
+	ip, userAgent := clientIP(r), r.UserAgent()
+	if app.jwt == nil {
+		return models.Tokens.NewSession(userID, family, app.config.tokens.accessTTL, app.config.tokens.refreshTTL, ip, userAgent)
+	}
+	user, err := models.Users.Get(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	permissions, err := models.Permissions.GetAllForUser(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	refresh, err := models.Tokens.NewRefresh(userID, family, app.config.tokens.refreshTTL, ip, userAgent)
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	access := &data.Token{
+		UserID: userID,
+		Expiry: now.Add(app.config.tokens.accessTTL).Truncate(time.Second),
+		Scope:  data.ScopeAuthentication,
+		Family: refresh.Family,
+	}
+	access.Plaintext, err = app.jwt.Sign(jwt.Claims{
+		Subject:     strconv.FormatInt(userID, 10),
+		IssuedAt:    now.Unix(),
+		IssuedAtMs:  now.UnixMilli(),
+		ExpiresAt:   access.Expiry.Unix(),
+		Session:     refresh.Family,
+		Activated:   user.Activated,
+		Permissions: permissions,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return access, refresh, nil
+}
+
+func (app *application) authenticateJWT(r *http.Request, token string) (*http.Request, error) {
+	claims, err := app.jwt.Verify(token, time.Now())
+	if err != nil {
+		return r, err
+	}
+	id, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil || id < 1 {
+		return r, jwt.ErrInvalidToken
+	}
+	issuedAt := time.UnixMilli(claims.IssuedAtMs)
+	if app.denylist.Revoked(fmt.Sprintf("user:%d", id), issuedAt) || app.denylist.Revoked(fmt.Sprintf("session:%d", claims.Session), issuedAt) {
+		return r, errTokenRevoked
+	}
+	r = app.contextSetUser(r, &data.User{ID: id, Activated: claims.Activated})
+	return app.contextSetSession(r, &authSession{family: claims.Session, claims: claims}), nil
+}
+
+func (app *application) permissionsFor(r *http.Request) (data.Permissions, error) {
+	if claims := app.contextGetSession(r).claims; claims != nil {
+		return claims.Permissions, nil
+	}
+	return app.models.Permissions.GetAllForUser(app.contextGetUser(r).ID)
+}
+
+func (app *application) revokeSessions(families ...int64) {
+	if app.jwt == nil {
+		return
+	}
+	for _, family := range families {
+		app.denylist.Revoke(fmt.Sprintf("session:%d", family))
+	}
+}
+
+func (app *application) revokeUserSessions(userID int64) {
+	if app.jwt == nil {
+		return
+	}
+	app.denylist.Revoke(fmt.Sprintf("user:%d", userID))
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"golang.assignment2.com/internal/data"
+)
+
+const (
+	maxLoginDelay         = time.Minute
+	maxLockout            = 24 * time.Hour
+	loginAttemptRetention = 2 * maxLockout
+)
+
+type loginKey struct {
+	kind      string
+	key       string
+	threshold int
+}
+
+func (app *application) loginKeys(r *http.Request, email string) []loginKey {
+	return []loginKey{
+		{kind: data.LoginAttemptEmail, key: strings.ToLower(email), threshold: app.config.login.emailThreshold},
+		{kind: data.LoginAttemptIP, key: clientIP(r), threshold: app.config.login.ipThreshold},
+	}
+}
+
+func (app *application) loginDelay(failures int) time.Duration {
+	if app.config.login.delay <= 0 || failures < 1 {
+		return 0
+	}
+	delay := app.config.login.delay
+	for i := 1; i < failures && delay < maxLoginDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxLoginDelay {
+		return maxLoginDelay
+	}
+	return delay
+}
+
+func (app *application) lockoutDuration(lockouts int) time.Duration {
+	duration := app.config.login.lockout
+	for i := 0; i < lockouts && duration < maxLockout; i++ {
+		duration *= 2
+	}
+	if duration > maxLockout {
+		return maxLockout
+	}
+	return duration
+}
+
+func (app *application) loginRetryAfter(k loginKey, attempt *data.LoginAttempt) time.Duration {
+	var until time.Time
+	if k.kind == data.LoginAttemptEmail {
+		until = attempt.LastFailureAt.Add(app.loginDelay(attempt.Failures))
+	}
+	if attempt.Locked() && attempt.LockedUntil.After(until) {
+		until = *attempt.LockedUntil
+	}
+	wait := time.Until(until)
+	if attempt.Failures >= k.threshold && time.Since(attempt.LastFailureAt) < app.config.login.window && wait < time.Second {
+		wait = time.Second
+	}
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+type loginReservation struct {
+	loginKey
+	attempt *data.LoginAttempt
+}
+
+func (app *application) reserveLogin(w http.ResponseWriter, r *http.Request, email string) ([]loginReservation, bool) {
+	tx, models, err := app.models.BeginTx(r.Context())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+	defer tx.Rollback()
+	keys := app.loginKeys(r, email)
+	reserved := make([]loginReservation, len(keys))
+	var wait time.Duration
+	for i, k := range keys {
+		attempt, err := models.LoginAttempts.Acquire(k.kind, k.key)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return nil, false
+		}
+		if d := app.loginRetryAfter(k, attempt); d > wait {
+			wait = d
+		}
+		reserved[i] = loginReservation{loginKey: k, attempt: attempt}
+	}
+	if wait > 0 {
+		app.loginLockedResponse(w, r, wait)
+		return nil, false
+	}
+	for _, res := range reserved {
+		err = models.LoginAttempts.Reserve(res.attempt, app.config.login.window)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return nil, false
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+	return reserved, true
+}
+
+func (app *application) recordLoginFailure(r *http.Request, email string, reserved []loginReservation) {
+	ip := clientIP(r)
+	app.logger.PrintInfo("login failed", map[string]string{
+		"email": email,
+		"ip":    ip,
+	})
+	for _, res := range reserved {
+		if res.attempt.Failures < res.threshold {
+			continue
+		}
+		err := app.models.LoginAttempts.Lock(res.attempt, app.lockoutDuration(res.attempt.Lockouts), res.threshold)
+		if err != nil {
+			if !errors.Is(err, data.ErrRecordNotFound) {
+				app.logError(r, err)
+			}
+			continue
+		}
+		app.logger.PrintInfo("login locked out", map[string]string{
+			"kind":         res.kind,
+			"key":          res.key,
+			"ip":           ip,
+			"lockouts":     strconv.Itoa(res.attempt.Lockouts),
+			"locked_until": res.attempt.LockedUntil.Format(time.RFC3339),
+		})
+		if res.kind == data.LoginAttemptEmail {
+			app.notifyLockout(email, ip, *res.attempt.LockedUntil)
+		}
+	}
+}
+
+func (app *application) releaseLogin(r *http.Request, reserved []loginReservation, succeeded bool) {
+	for _, res := range reserved {
+		var err error
+		if succeeded && res.kind == data.LoginAttemptEmail {
+			err = app.models.LoginAttempts.Clear(res.kind, res.key)
+		} else {
+			err = app.models.LoginAttempts.Release(res.kind, res.key)
+		}
+		if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+			app.logError(r, err)
+		}
+	}
+}
+
+func (app *application) notifyLockout(email, ip string, lockedUntil time.Time) {
+	app.background(func() {
+		user, err := app.models.Users.GetByEmail(email)
+		if err != nil {
+			if !errors.Is(err, data.ErrRecordNotFound) {
+				app.logger.PrintError(err, nil)
+			}
+			return
+		}
+		data := map[string]interface{}{
+			"name":        user.Name,
+			"ip":          ip,
+			"lockedUntil": lockedUntil.UTC().Format(time.RFC1123),
+		}
+		err = app.mailer.Send(user.Email, "account_locked.tmpl", data)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+}
+
+func (app *application) deleteExpiredLoginAttempts() {
+	retention := loginAttemptRetention
+	if app.config.login.window > retention {
+		retention = app.config.login.window
+	}
+	deleted, err := app.models.LoginAttempts.DeleteExpired(retention)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+	app.logger.PrintInfo("expired login attempts deleted", map[string]string{
+		"deleted": strconv.FormatInt(deleted, 10),
+	})
+}
+
+func (app *application) clearUserLockoutHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUser(w, r)
+	if !ok {
+		return
+	}
+	err := app.models.LoginAttempts.Clear(data.LoginAttemptEmail, strings.ToLower(user.Email))
+	if err != nil {
+		app.dataErrorResponse(w, r, err)
+		return
+	}
+	app.logger.PrintInfo("login lockout cleared by admin", map[string]string{
+		"admin_id": strconv.FormatInt(app.contextGetUser(r).ID, 10),
+		"user_id":  strconv.FormatInt(user.ID, 10),
+	})
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "login lockout successfully cleared"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) clearIPLockoutHandler(w http.ResponseWriter, r *http.Request) {
+	ip := httprouter.ParamsFromContext(r.Context()).ByName("ip")
+	err := app.models.LoginAttempts.Clear(data.LoginAttemptIP, ip)
+	if err != nil {
+		app.dataErrorResponse(w, r, err)
+		return
+	}
+	app.logger.PrintInfo("login lockout cleared by admin", map[string]string{
+		"admin_id": strconv.FormatInt(app.contextGetUser(r).ID, 10),
+		"ip":       ip,
+	})
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "login lockout successfully cleared"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.assignment2.com/internal/data"
+)
+
+func TestLoginDelay(t *testing.T) {
+	app := &application{}
+	app.config.login.delay = time.Second
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{6, 32 * time.Second},
+		{7, maxLoginDelay},
+		{1000, maxLoginDelay},
+	}
+	for _, tt := range tests {
+		if got := app.loginDelay(tt.failures); got != tt.want {
+			t.Errorf("loginDelay(%d): got %s; want %s", tt.failures, got, tt.want)
+		}
+	}
+	app.config.login.delay = 0
+	if got := app.loginDelay(5); got != 0 {
+		t.Errorf("disabled loginDelay(5): got %s; want 0", got)
+	}
+}
+
+func TestLockoutDuration(t *testing.T) {
+	app := &application{}
+	app.config.login.lockout = 15 * time.Minute
+	tests := []struct {
+		lockouts int
+		want     time.Duration
+	}{
+		{0, 15 * time.Minute},
+		{1, 30 * time.Minute},
+		{3, 2 * time.Hour},
+		{6, 16 * time.Hour},
+		{7, maxLockout},
+		{1000, maxLockout},
+	}
+	for _, tt := range tests {
+		if got := app.lockoutDuration(tt.lockouts); got != tt.want {
+			t.Errorf("lockoutDuration(%d): got %s; want %s", tt.lockouts, got, tt.want)
+		}
+	}
+}
+
+func TestLoginRetryAfter(t *testing.T) {
+	app := &application{}
+	app.config.login.window = 15 * time.Minute
+	app.config.login.delay = time.Minute
+	email := loginKey{kind: data.LoginAttemptEmail, threshold: 5}
+	ip := loginKey{kind: data.LoginAttemptIP, threshold: 3}
+	now := time.Now()
+	lockedUntil := now.Add(10 * time.Minute)
+	tests := []struct {
+		name    string
+		key     loginKey
+		attempt data.LoginAttempt
+		min     time.Duration
+		max     time.Duration
+	}{
+		{"fresh", email, data.LoginAttempt{LastFailureAt: now}, 0, 0},
+		{"email delay", email, data.LoginAttempt{Failures: 1, LastFailureAt: now}, 59 * time.Second, time.Minute},
+		{"ip has no delay", ip, data.LoginAttempt{Failures: 1, LastFailureAt: now}, 0, 0},
+		{"locked", ip, data.LoginAttempt{LastFailureAt: now, LockedUntil: &lockedUntil}, 9 * time.Minute, 10 * time.Minute},
+		{"reservations at threshold", ip, data.LoginAttempt{Failures: 3, LastFailureAt: now}, time.Second, time.Second},
+		{"stale failures", ip, data.LoginAttempt{Failures: 3, LastFailureAt: now.Add(-time.Hour)}, 0, 0},
+	}
+	for _, tt := range tests {
+		got := app.loginRetryAfter(tt.key, &tt.attempt)
+		if got < tt.min || got > tt.max {
+			t.Errorf("%s: got %s; want between %s and %s", tt.name, got, tt.min, tt.max)
+		}
+	}
+}
+
+func TestConcurrentLoginFailuresLockOnce(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.login.emailThreshold = 3
+	ts := newTestServer(t, app)
+	insertTestUser(t, app, "alice@example.com")
+
+	statuses := make([]int, 6)
+	var wg sync.WaitGroup
+	for i := range statuses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			statuses[i], _ = ts.do(t, http.MethodPost, "/v1/tokens/authentication", "", envelope{"email": "alice@example.com", "password": "wrong-password"})
+		}(i)
+	}
+	wg.Wait()
+	for _, status := range statuses {
+		if status != http.StatusUnauthorized && status != http.StatusTooManyRequests {
+			t.Errorf("got status %d; want %d or %d", status, http.StatusUnauthorized, http.StatusTooManyRequests)
+		}
+	}
+	attempt, err := app.models.LoginAttempts.Get(data.LoginAttemptEmail, "alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempt.Lockouts > 1 {
+		t.Errorf("got %d lockouts; want at most 1", attempt.Lockouts)
+	}
+	if attempt.Lockouts == 1 {
+		status, _ := ts.do(t, http.MethodPost, "/v1/tokens/authentication", "", envelope{"email": "alice@example.com", "password": testPassword})
+		if status != http.StatusTooManyRequests {
+			t.Errorf("login while locked: got status %d; want %d", status, http.StatusTooManyRequests)
+		}
+	}
+}
+
+func TestSuccessfulLoginReleasesReservations(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app)
+	insertTestUser(t, app, "alice@example.com")
+	for i := 0; i < app.config.login.ipThreshold+1; i++ {
+		ts.login(t, "alice@example.com", testPassword)
+	}
+	attempt, err := app.models.LoginAttempts.Get(data.LoginAttemptIP, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempt.Failures != 0 {
+		t.Errorf("got %d ip failures after successful logins; want 0", attempt.Failures)
+	}
+}
@@ -3,7 +3,9 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"flag"
+	"fmt"
 	"os"
 	"strings"
 	"sync"
@@ -11,8 +13,11 @@ import (
 
 	_ "github.com/lib/pq"
 	"golang.assignment2.com/internal/data"
+	"golang.assignment2.com/internal/events"
 	"golang.assignment2.com/internal/jsonlog"
+	"golang.assignment2.com/internal/jwt"
 	"golang.assignment2.com/internal/mailer"
+	"golang.assignment2.com/internal/validator"
 )
 
 type config struct {
@@ -39,14 +44,63 @@ type config struct {
 	cors struct {
 		trustedOrigins []string
 	}
+	savedSearches struct {
+		interval time.Duration
+	}
+	search struct {
+		language string
+	}
+	idempotency struct {
+		ttl time.Duration
+	}
+	openapi struct {
+		validate bool
+	}
+	problems struct {
+		typeBase string
+	}
+	events struct {
+		logSize   int
+		heartbeat time.Duration
+	}
+	webhooks struct {
+		interval    time.Duration
+		maxAttempts int
+		backoff     time.Duration
+	}
+	activation struct {
+		resendInterval time.Duration
+	}
+	login struct {
+		window         time.Duration
+		delay          time.Duration
+		emailThreshold int
+		ipThreshold    int
+		lockout        time.Duration
+	}
+	tokens struct {
+		format     string
+		accessTTL  time.Duration
+		refreshTTL time.Duration
+	}
+	jwt struct {
+		algorithm string
+		keys      string
+		activeKey string
+	}
 }
 
 type application struct {
-	config config
-	logger *jsonlog.Logger
-	models data.Models
-	mailer mailer.Mailer
-	wg     sync.WaitGroup
+	config             config
+	logger             *jsonlog.Logger
+	models             data.Models
+	mailer             mailer.Mailer
+	wg                 sync.WaitGroup
+	openapi            *openAPIDocument
+	events             *events.Broker
+	activationThrottle *throttle
+	jwt                *jwt.Signer
+	denylist           *jwt.Denylist
 }
 
 func main() {
@@ -75,9 +129,68 @@ func main() {
 		return nil
 	})
 
+	flag.DurationVar(&cfg.savedSearches.interval, "saved-search-interval", 15*time.Minute, "Interval between saved search notification runs (0 disables)")
+
+	flag.StringVar(&cfg.search.language, "search-language", "simple", "Default full-text search configuration")
+
+	flag.DurationVar(&cfg.idempotency.ttl, "idempotency-key-ttl", 24*time.Hour, "How long idempotency keys and their stored responses are kept")
+
+	flag.BoolVar(&cfg.openapi.validate, "openapi-validate", false, "Validate incoming requests against the generated OpenAPI document")
+
+	flag.StringVar(&cfg.problems.typeBase, "problem-type-base", "about:blank", "URI prefix for problem detail types, joined with the error code (about:blank omits it)")
+
+	flag.IntVar(&cfg.events.logSize, "events-log-size", 1000, "Number of recent events kept for Last-Event-ID resumption")
+	flag.DurationVar(&cfg.events.heartbeat, "events-heartbeat", 15*time.Second, "Interval between heartbeats on event streams")
+
+	flag.DurationVar(&cfg.webhooks.interval, "webhook-interval", 5*time.Second, "Interval between webhook delivery runs (0 disables)")
+	flag.IntVar(&cfg.webhooks.maxAttempts, "webhook-max-attempts", 8, "Delivery attempts before a webhook delivery is dead-lettered")
+	flag.DurationVar(&cfg.webhooks.backoff, "webhook-backoff", 30*time.Second, "Delay before the first webhook retry, doubled on each further attempt")
+
+	flag.DurationVar(&cfg.activation.resendInterval, "activation-resend-interval", 5*time.Minute, "Minimum time between activation emails resent to one address (0 disables)")
+
+	flag.DurationVar(&cfg.login.window, "login-failure-window", 15*time.Minute, "How long failed login attempts are remembered")
+	flag.DurationVar(&cfg.login.delay, "login-delay", time.Second, "Delay enforced after the first failed login, doubled on each further failure (0 disables)")
+	flag.IntVar(&cfg.login.emailThreshold, "login-lockout-threshold", 5, "Failed logins for one email address before it is locked")
+	flag.IntVar(&cfg.login.ipThreshold, "login-ip-lockout-threshold", 20, "Failed logins from one IP address before it is locked")
+	flag.DurationVar(&cfg.login.lockout, "login-lockout-duration", 15*time.Minute, "Duration of the first lockout, doubled on each further lockout")
+
+	flag.StringVar(&cfg.tokens.format, "token-format", "opaque", "Authentication token format (opaque|jwt); jwt revocations are held in a per-process denylist that is cleared on restart")
+	flag.DurationVar(&cfg.tokens.accessTTL, "access-token-ttl", 15*time.Minute, "Lifetime of authentication tokens")
+	flag.DurationVar(&cfg.tokens.refreshTTL, "refresh-token-ttl", 30*24*time.Hour, "Lifetime of refresh tokens, extended on every refresh")
+
+	flag.StringVar(&cfg.jwt.algorithm, "jwt-algorithm", jwt.HS256, "Signing algorithm for jwt tokens (HS256|EdDSA)")
+	flag.StringVar(&cfg.jwt.keys, "jwt-keys", os.Getenv("GREENLIGHT_JWT_KEYS"), "Signing keys for jwt tokens as space separated kid=base64 pairs")
+	flag.StringVar(&cfg.jwt.activeKey, "jwt-active-key", "", "Key ID used to sign new jwt tokens (defaults to the first key)")
+
 	flag.Parse()
 
 	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
+	if !validator.In(cfg.search.language, data.SearchLanguages...) {
+		logger.PrintFatal(fmt.Errorf("unsupported search language %q", cfg.search.language), nil)
+	}
+	if cfg.events.logSize < 1 || cfg.events.heartbeat <= 0 {
+		logger.PrintFatal(errors.New("events-log-size and events-heartbeat must be positive"), nil)
+	}
+	if cfg.webhooks.maxAttempts < 1 || cfg.webhooks.backoff <= 0 {
+		logger.PrintFatal(errors.New("webhook-max-attempts and webhook-backoff must be positive"), nil)
+	}
+	if cfg.login.window <= 0 || cfg.login.lockout <= 0 || cfg.login.emailThreshold < 1 || cfg.login.ipThreshold < 1 {
+		logger.PrintFatal(errors.New("login-failure-window, login-lockout-duration and the lockout thresholds must be positive"), nil)
+	}
+	if cfg.tokens.accessTTL <= 0 || cfg.tokens.refreshTTL <= 0 {
+		logger.PrintFatal(errors.New("access-token-ttl and refresh-token-ttl must be positive"), nil)
+	}
+	if !validator.In(cfg.tokens.format, "opaque", "jwt") {
+		logger.PrintFatal(fmt.Errorf("unsupported token format %q", cfg.tokens.format), nil)
+	}
+	var signer *jwt.Signer
+	if cfg.tokens.format == "jwt" {
+		var err error
+		signer, err = newJWTSigner(cfg)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+	}
 	db, err := openDB(cfg)
 	if err != nil {
 		logger.PrintFatal(err, nil)
@@ -85,10 +198,14 @@ func main() {
 	defer db.Close()
 	logger.PrintInfo("database connection pool established", nil)
 	app := &application{
-		config: cfg,
-		logger: logger,
-		models: data.NewModels(db),
-		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		config:             cfg,
+		logger:             logger,
+		models:             data.NewModels(db),
+		events:             events.New(cfg.events.logSize),
+		activationThrottle: newThrottle(cfg.activation.resendInterval),
+		jwt:                signer,
+		denylist:           jwt.NewDenylist(cfg.tokens.accessTTL),
+		mailer:             mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
 	}
 	err = app.serve()
 	if err != nil {
@@ -1,10 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
@@ -14,6 +20,26 @@ import (
 	"golang.org/x/time/rate"
 )
 
+var requestIDRX = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,64}$`)
+
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !requestIDRX.MatchString(id) {
+			randomBytes := make([]byte, 16)
+			_, err := rand.Read(randomBytes)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			id = hex.EncodeToString(randomBytes)
+		}
+		w.Header().Set("X-Request-ID", id)
+		r = app.contextSetRequestID(r, id)
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
@@ -88,6 +114,15 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			return
 		}
 		token := headerParts[1]
+		if app.jwt != nil && strings.Count(token, ".") == 2 {
+			r, err := app.authenticateJWT(r, token)
+			if err != nil {
+				app.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
 		v := validator.New()
 		if data.ValidateTokenPlaintext(v, token); !v.Valid() {
 			app.invalidAuthenticationTokenResponse(w, r)
@@ -103,7 +138,16 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			}
 			return
 		}
+		if user.Disabled() {
+			app.accountDisabledResponse(w, r)
+			return
+		}
+		family, err := app.models.Tokens.Touch(token, clientIP(r), r.UserAgent())
+		if err != nil {
+			app.logError(r, err)
+		}
 		r = app.contextSetUser(r, user)
+		r = app.contextSetSession(r, &authSession{family: family})
 		next.ServeHTTP(w, r)
 	})
 }
@@ -119,6 +163,29 @@ func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.Han
 	})
 }
 
+func (app *application) loadUser(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.contextGetSession(r).claims != nil {
+			user, err := app.models.Users.Get(app.contextGetUser(r).ID)
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrRecordNotFound):
+					app.invalidAuthenticationTokenResponse(w, r)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+			if user.Disabled() {
+				app.accountDisabledResponse(w, r)
+				return
+			}
+			r = app.contextSetUser(r, user)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) requireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
 	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := app.contextGetUser(r)
@@ -133,8 +200,7 @@ func (app *application) requireActivatedUser(next http.HandlerFunc) http.Handler
 
 func (app *application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
 	fn := func(w http.ResponseWriter, r *http.Request) {
-		user := app.contextGetUser(r)
-		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+		permissions, err := app.permissionsFor(r)
 		if err != nil {
 			app.serverErrorResponse(w, r, err)
 			return
@@ -157,9 +223,10 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 			for i := range app.config.cors.trustedOrigins {
 				if origin == app.config.cors.trustedOrigins[i] {
 					w.Header().Set("Access-Control-Allow-Origin", origin)
+					w.Header().Set("Access-Control-Expose-Headers", "Link")
 					if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
 						w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, PUT, PATCH, DELETE")
-						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Idempotency-Key")
 						w.WriteHeader(http.StatusOK)
 						return
 					}
@@ -170,3 +237,154 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+func (app *application) negotiate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		enc := negotiateEncoder(r.URL.Query().Get("format"), r.Header.Get("Accept"))
+		if enc == nil {
+			app.notAcceptableResponse(w, r)
+			return
+		}
+		r = app.contextSetEncoder(r, enc)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (app *application) compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateContentEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+		defer func() {
+			err := cw.Close()
+			if err != nil {
+				app.logError(r, err)
+			}
+		}()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	if rr.status == 0 {
+		rr.status = status
+	}
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	rr.body.Write(b)
+	return rr.ResponseWriter.Write(b)
+}
+
+func (rr *responseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
+
+func (app *application) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		v := validator.New()
+		if data.ValidateIdempotencyKey(v, key); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(app.contextGetRoute(r).bodyLimit())))
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		hash := sha256.New()
+		for _, part := range []string{r.Method, r.URL.Path, r.URL.RawQuery, r.Header.Get("Content-Type"), r.Header.Get("Accept")} {
+			hash.Write([]byte(part))
+			hash.Write([]byte{0})
+		}
+		hash.Write(body)
+		user := app.contextGetUser(r)
+		rec := &data.IdempotencyRecord{
+			UserID:      user.ID,
+			Key:         key,
+			Fingerprint: hash.Sum(nil),
+			Expiry:      time.Now().Add(app.config.idempotency.ttl),
+		}
+		reserved, err := app.models.Idempotency.Reserve(rec)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !reserved {
+			stored, err := app.models.Idempotency.Get(user.ID, key)
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrRecordNotFound):
+					app.idempotencyKeyInProgressResponse(w, r)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+			switch {
+			case !bytes.Equal(stored.Fingerprint, rec.Fingerprint):
+				app.idempotencyKeyReusedResponse(w, r)
+			case !stored.Completed():
+				app.idempotencyKeyInProgressResponse(w, r)
+			default:
+				for name, values := range stored.Headers {
+					w.Header()[name] = values
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(stored.Status)
+				w.Write(stored.Body)
+			}
+			return
+		}
+		completed := false
+		defer func() {
+			if completed {
+				return
+			}
+			err := app.models.Idempotency.Delete(user.ID, key)
+			if err != nil {
+				app.logError(r, err)
+			}
+		}()
+		rw := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rw, r)
+		if rw.status == 0 || rw.status >= 500 {
+			return
+		}
+		rec.Status = rw.status
+		rec.Body = rw.body.Bytes()
+		rec.Headers = make(map[string][]string)
+		for _, name := range []string{"Content-Type", "Location"} {
+			if values := w.Header().Values(name); len(values) > 0 {
+				rec.Headers[name] = values
+			}
+		}
+		err = app.models.Idempotency.Complete(rec)
+		if err != nil {
+			app.logError(r, err)
+			return
+		}
+		completed = true
+	})
+}
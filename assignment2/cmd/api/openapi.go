@@ -0,0 +1,512 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"golang.assignment2.com/internal/validator"
+)
+
+const schemaRefPrefix = "#/components/schemas/"
+
+type openAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 interface{}               `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Description          string                    `json:"description,omitempty"`
+	Enum                 []string                  `json:"enum,omitempty"`
+	Minimum              *int64                    `json:"minimum,omitempty"`
+	Properties           map[string]*openAPISchema `json:"properties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	AdditionalProperties interface{}               `json:"additionalProperties,omitempty"`
+	Items                *openAPISchema            `json:"items,omitempty"`
+}
+
+type openAPIParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required,omitempty"`
+	Schema      *openAPISchema `json:"schema"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIOperation struct {
+	OperationID string                     `json:"operationId"`
+	Summary     string                     `json:"summary,omitempty"`
+	Parameters  []openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+	Security    []map[string][]string      `json:"security,omitempty"`
+	Permission  string                     `json:"x-permission,omitempty"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type openAPIComponents struct {
+	Schemas         map[string]*openAPISchema    `json:"schemas"`
+	SecuritySchemes map[string]map[string]string `json:"securitySchemes"`
+}
+
+type openAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       openAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components openAPIComponents                       `json:"components"`
+}
+
+func newOpenAPIDocument(routes []route) *openAPIDocument {
+	doc := &openAPIDocument{
+		OpenAPI: "3.1.0",
+		Info:    openAPIInfo{Title: "Greenlight API", Version: "1.0.0"},
+		Paths:   make(map[string]map[string]*openAPIOperation),
+		Components: openAPIComponents{
+			Schemas: make(map[string]*openAPISchema),
+			SecuritySchemes: map[string]map[string]string{
+				"bearerAuth": {"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+	problemSchema := doc.typeSchema(reflect.TypeOf(problem{}), false)
+	formats := make([]string, len(responseEncoders))
+	for i, enc := range responseEncoders {
+		formats[i] = enc.format
+	}
+	for _, rt := range routes {
+		path, params := openAPIPath(rt.path)
+		op := &openAPIOperation{
+			OperationID: openAPIOperationID(rt.method, rt.path),
+			Summary:     rt.summary,
+			Parameters:  params,
+			Responses:   make(map[string]openAPIResponse),
+			Permission:  rt.permission,
+		}
+		for _, q := range rt.query {
+			schema := &openAPISchema{Type: "string"}
+			if q.integer {
+				schema = &openAPISchema{Type: "integer", Format: "int64"}
+			}
+			op.Parameters = append(op.Parameters, openAPIParameter{Name: q.name, In: "query", Description: q.description, Schema: schema})
+		}
+		op.Parameters = append(op.Parameters, openAPIParameter{
+			Name:        "format",
+			In:          "query",
+			Description: "Response format, overrides the Accept header",
+			Schema:      &openAPISchema{Type: "string", Enum: formats},
+		})
+		if rt.idempotent {
+			op.Parameters = append(op.Parameters, openAPIParameter{
+				Name:        "Idempotency-Key",
+				In:          "header",
+				Description: "Client-generated key that makes retries of this request safe",
+				Schema:      &openAPISchema{Type: "string"},
+			})
+		}
+		if rt.input != nil {
+			schema := doc.valueSchema(rt.input, true)
+			op.RequestBody = &openAPIRequestBody{
+				Required: true,
+				Content:  make(map[string]openAPIMediaType),
+			}
+			for _, mediaType := range rt.acceptedContentTypes() {
+				switch mediaType {
+				case mediaTypeJSONPatch:
+					op.RequestBody.Content[mediaType] = openAPIMediaType{Schema: jsonPatchSchema()}
+				default:
+					op.RequestBody.Content[mediaType] = openAPIMediaType{Schema: schema}
+				}
+			}
+		}
+		status := rt.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		contentType := rt.contentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		op.Responses[strconv.Itoa(status)] = openAPIResponse{
+			Description: http.StatusText(status),
+			Content:     map[string]openAPIMediaType{contentType: {Schema: doc.valueSchema(rt.output, false)}},
+		}
+		op.Responses["default"] = openAPIResponse{
+			Description: "Problem details",
+			Content:     map[string]openAPIMediaType{"application/problem+json": {Schema: problemSchema}},
+		}
+		if rt.permission != "" || rt.activated || rt.authenticated {
+			op.Security = []map[string][]string{{"bearerAuth": {}}}
+		}
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]*openAPIOperation)
+		}
+		doc.Paths[path][strings.ToLower(rt.method)] = op
+	}
+	return doc
+}
+
+func openAPIPath(path string) (string, []openAPIParameter) {
+	var params []openAPIParameter
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if !strings.HasPrefix(segment, ":") {
+			continue
+		}
+		name := strings.TrimPrefix(segment, ":")
+		schema := &openAPISchema{Type: "string"}
+		if name == "id" || strings.HasSuffix(name, "_id") {
+			minimum := int64(1)
+			schema = &openAPISchema{Type: "integer", Format: "int64", Minimum: &minimum}
+		}
+		params = append(params, openAPIParameter{Name: name, In: "path", Required: true, Schema: schema})
+		segments[i] = "{" + name + "}"
+	}
+	return strings.Join(segments, "/"), params
+}
+
+func openAPIOperationID(method, path string) string {
+	id := strings.ToLower(method)
+	for _, segment := range strings.Split(path, "/") {
+		segment = strings.NewReplacer(":", "", "-", "_", ".", "_").Replace(segment)
+		if segment != "" {
+			id += "_" + segment
+		}
+	}
+	return id
+}
+
+func jsonPatchSchema() *openAPISchema {
+	return &openAPISchema{
+		Type: "array",
+		Items: &openAPISchema{
+			Type: "object",
+			Properties: map[string]*openAPISchema{
+				"op":    {Type: "string", Enum: []string{"add", "remove", "replace", "move", "copy", "test"}},
+				"path":  {Type: "string"},
+				"from":  {Type: "string"},
+				"value": {},
+			},
+			Required:             []string{"op", "path"},
+			AdditionalProperties: false,
+		},
+	}
+}
+
+func (doc *openAPIDocument) valueSchema(value interface{}, input bool) *openAPISchema {
+	env, ok := value.(envelope)
+	if !ok {
+		return doc.typeSchema(reflect.TypeOf(value), input)
+	}
+	schema := &openAPISchema{Type: "object", Properties: make(map[string]*openAPISchema)}
+	for _, key := range sortedKeys(env) {
+		schema.Properties[key] = doc.typeSchema(reflect.TypeOf(env[key]), input)
+		schema.Required = append(schema.Required, key)
+	}
+	return schema
+}
+
+func (doc *openAPIDocument) typeSchema(t reflect.Type, input bool) *openAPISchema {
+	switch t {
+	case nil, reflect.TypeOf(json.RawMessage{}):
+		return &openAPISchema{}
+	case reflect.TypeOf(time.Time{}):
+		return &openAPISchema{Type: "string", Format: "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := doc.typeSchema(t.Elem(), input)
+		if typ, ok := schema.Type.(string); ok {
+			schema.Type = []string{typ, "null"}
+		}
+		return schema
+	case reflect.Bool:
+		return &openAPISchema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return &openAPISchema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return &openAPISchema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &openAPISchema{Type: "number"}
+	case reflect.String:
+		return &openAPISchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &openAPISchema{Type: "string", Format: "byte"}
+		}
+		return &openAPISchema{Type: "array", Items: doc.typeSchema(t.Elem(), input)}
+	case reflect.Map:
+		return &openAPISchema{Type: "object", AdditionalProperties: doc.typeSchema(t.Elem(), input)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return doc.structSchema(t, input)
+		}
+		if _, ok := doc.Components.Schemas[t.Name()]; !ok {
+			doc.Components.Schemas[t.Name()] = &openAPISchema{}
+			*doc.Components.Schemas[t.Name()] = *doc.structSchema(t, input)
+		}
+		return &openAPISchema{Ref: schemaRefPrefix + t.Name()}
+	}
+	return &openAPISchema{}
+}
+
+func (doc *openAPIDocument) structSchema(t reflect.Type, input bool) *openAPISchema {
+	schema := &openAPISchema{Type: "object", Properties: make(map[string]*openAPISchema)}
+	if input {
+		schema.AdditionalProperties = false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			embedded := doc.structSchema(field.Type, input)
+			for key, property := range embedded.Properties {
+				schema.Properties[key] = property
+			}
+			schema.Required = append(schema.Required, embedded.Required...)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		schema.Properties[name] = doc.typeSchema(field.Type, input)
+		if !input && !strings.Contains(options, "omitempty") && field.Type.Kind() != reflect.Pointer {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	return schema
+}
+
+func (doc *openAPIDocument) operation(rt route) *openAPIOperation {
+	path, _ := openAPIPath(rt.path)
+	return doc.Paths[path][strings.ToLower(rt.method)]
+}
+
+func (doc *openAPIDocument) resolve(schema *openAPISchema) *openAPISchema {
+	for schema.Ref != "" {
+		schema = doc.Components.Schemas[strings.TrimPrefix(schema.Ref, schemaRefPrefix)]
+	}
+	return schema
+}
+
+func (s *openAPISchema) types() []string {
+	switch typ := s.Type.(type) {
+	case string:
+		return []string{typ}
+	case []string:
+		return typ
+	}
+	return nil
+}
+
+func (s *openAPISchema) allows(typ string) bool {
+	for _, t := range s.types() {
+		if t == typ || (t == "number" && typ == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func (doc *openAPIDocument) validateValue(v *validator.Validator, key string, schema *openAPISchema, value interface{}) {
+	schema = doc.resolve(schema)
+	types := schema.types()
+	if len(types) == 0 {
+		return
+	}
+	field := key
+	if field == "" {
+		field = "body"
+	}
+	message := "must be of type " + strings.Join(types, " or ")
+	switch value := value.(type) {
+	case nil:
+		if !schema.allows("null") {
+			v.AddError(field, "must not be null")
+		}
+	case map[string]interface{}:
+		if !schema.allows("object") {
+			v.AddError(field, message)
+			return
+		}
+		for _, name := range schema.Required {
+			if _, ok := value[name]; !ok {
+				v.AddError(joinFieldKey(key, name), "must be provided")
+			}
+		}
+		for _, name := range sortedKeys(value) {
+			if property, ok := schema.Properties[name]; ok {
+				doc.validateValue(v, joinFieldKey(key, name), property, value[name])
+				continue
+			}
+			switch additional := schema.AdditionalProperties.(type) {
+			case bool:
+				if !additional {
+					v.AddError(joinFieldKey(key, name), "unknown field")
+				}
+			case *openAPISchema:
+				doc.validateValue(v, joinFieldKey(key, name), additional, value[name])
+			}
+		}
+	case []interface{}:
+		if !schema.allows("array") {
+			v.AddError(field, message)
+			return
+		}
+		if schema.Items != nil {
+			for i, item := range value {
+				doc.validateValue(v, fmt.Sprintf("%s[%d]", key, i), schema.Items, item)
+			}
+		}
+	case string:
+		if !schema.allows("string") {
+			v.AddError(field, message)
+			return
+		}
+		if len(schema.Enum) > 0 && !validator.In(value, schema.Enum...) {
+			v.AddError(field, "must be one of "+strings.Join(schema.Enum, ", "))
+		}
+	case bool:
+		if !schema.allows("boolean") {
+			v.AddError(field, message)
+		}
+	case json.Number:
+		if schema.allows("number") {
+			return
+		}
+		if !schema.allows("integer") {
+			v.AddError(field, message)
+			return
+		}
+		n, err := strconv.ParseInt(value.String(), 10, 64)
+		switch {
+		case err != nil:
+			v.AddError(field, "must be an integer value")
+		case schema.Format == "int32" && (n < math.MinInt32 || n > math.MaxInt32):
+			v.AddError(field, "must be a 32-bit integer value")
+		case schema.Minimum != nil && n < *schema.Minimum:
+			v.AddError(field, fmt.Sprintf("must be greater than or equal to %d", *schema.Minimum))
+		}
+	}
+}
+
+func joinFieldKey(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+func (app *application) bufferBody(w http.ResponseWriter, r *http.Request, maxBytes int) ([]byte, error) {
+	err := app.limitBody(w, r, maxBytes)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			return nil, fmt.Errorf("body must not be larger than %d bytes", maxBytes)
+		}
+		return nil, errors.New("body contains badly-formed gzip data")
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.Header.Del("Content-Encoding")
+	return body, nil
+}
+
+func (app *application) validateRequest(rt route, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		op := app.openapi.operation(rt)
+		v := validator.New()
+		params := httprouter.ParamsFromContext(r.Context())
+		query := r.URL.Query()
+		declared := make(map[string]bool)
+		for _, param := range op.Parameters {
+			switch param.In {
+			case "path":
+				if !param.Schema.allows("integer") {
+					continue
+				}
+				pv := validator.New()
+				app.openapi.validateValue(pv, param.Name, param.Schema, json.Number(params.ByName(param.Name)))
+				if !pv.Valid() {
+					app.notFoundResponse(w, r)
+					return
+				}
+			case "query":
+				declared[param.Name] = true
+				if !query.Has(param.Name) {
+					continue
+				}
+				var value interface{} = query.Get(param.Name)
+				if param.Schema.allows("integer") {
+					value = json.Number(query.Get(param.Name))
+				}
+				app.openapi.validateValue(v, param.Name, param.Schema, value)
+			}
+		}
+		for name := range query {
+			if !declared[name] {
+				v.AddError(name, "unknown query parameter")
+			}
+		}
+		mediaType := requestMediaType(r)
+		if mediaType == "" {
+			mediaType = mediaTypeJSON
+		}
+		if op.RequestBody != nil && mediaType == mediaTypeJSON {
+			body, err := app.bufferBody(w, r, rt.bodyLimit())
+			if err != nil {
+				app.badRequestResponse(w, r, err)
+				return
+			}
+			dec := json.NewDecoder(bytes.NewReader(body))
+			dec.UseNumber()
+			var value interface{}
+			if dec.Decode(&value) == nil {
+				app.openapi.validateValue(v, "", op.RequestBody.Content[mediaTypeJSON].Schema, value)
+			}
+		}
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (app *application) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.writeEncoded(w, jsonEncoder, jsonEncoder.contentType, http.StatusOK, app.openapi, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"golang.assignment2.com/internal/data"
+)
+
+func pageLink(r *http.Request, key, value string, remove ...string) string {
+	qs := r.URL.Query()
+	for _, name := range remove {
+		qs.Del(name)
+	}
+	if key != "" {
+		qs.Set(key, value)
+	}
+	u := url.URL{Path: r.URL.Path, RawQuery: qs.Encode()}
+	return u.String()
+}
+
+func (app *application) paginationLinks(r *http.Request, metadata *data.Metadata) http.Header {
+	links := &data.PageLinks{Self: r.URL.RequestURI()}
+	switch {
+	case r.URL.Query().Get("cursor") != "":
+		links.First = pageLink(r, "", "", "cursor", "page")
+		if metadata.NextCursor != "" {
+			links.Next = pageLink(r, "cursor", metadata.NextCursor, "page")
+		}
+	case metadata.LastPage > 0:
+		links.First = pageLink(r, "page", "1", "cursor")
+		links.Last = pageLink(r, "page", strconv.Itoa(metadata.LastPage), "cursor")
+		if metadata.CurrentPage > 1 {
+			prev := min(metadata.CurrentPage-1, metadata.LastPage)
+			links.Prev = pageLink(r, "page", strconv.Itoa(prev), "cursor")
+		}
+		if metadata.CurrentPage < metadata.LastPage {
+			links.Next = pageLink(r, "page", strconv.Itoa(metadata.CurrentPage+1), "cursor")
+		}
+	}
+	metadata.Links = links
+	headers := make(http.Header)
+	for _, link := range []struct{ rel, target string }{
+		{"self", links.Self},
+		{"first", links.First},
+		{"prev", links.Prev},
+		{"next", links.Next},
+		{"last", links.Last},
+	} {
+		if link.target != "" {
+			headers.Add("Link", fmt.Sprintf(`<%s>; rel="%s"`, link.target, link.rel))
+		}
+	}
+	return headers
+}
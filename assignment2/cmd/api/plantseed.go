@@ -1,45 +1,69 @@
 package main
 
 import (
-	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 
 	"golang.assignment2.com/internal/data"
 	"golang.assignment2.com/internal/validator"
 )
 
+type createPlantseedInput struct {
+	Name     string `json:"name"`
+	Family   string `json:"family"`
+	Amount   int32  `json:"amount,omitempty"`
+	Price    int32  `json:"price,omitempty"`
+	Language string `json:"language"`
+}
+
 func (app *application) createPlantseedHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		Name   string `json:"name"`
-		Family string `json:"family"`
-		Amount int32  `json:"amount,omitempty"`
-		Price  int32  `json:"price,omitempty"`
-	}
-	err := app.readJSON(w, r, &input)
+	var input createPlantseedInput
+	err := app.decodeRequest(w, r, &input)
 	if err != nil {
-		app.badRequestResponse(w, r, err)
+		app.decodeErrorResponse(w, r, err)
 		return
 	}
+	if input.Language == "" {
+		input.Language = app.config.search.language
+	}
 	plantseed := &data.Plantseed{
-		Name:   input.Name,
-		Family: input.Family,
-		Amount: input.Amount,
-		Price:  input.Price,
+		Name:     input.Name,
+		Family:   input.Family,
+		Amount:   input.Amount,
+		Price:    input.Price,
+		Language: input.Language,
 	}
 	v := validator.New()
 	if data.ValidateMovie(v, plantseed); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	err = app.models.Plantseed.Insert(plantseed)
+	tx, models, err := app.models.BeginTx(r.Context())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	defer tx.Rollback()
+	err = models.Plantseed.Insert(plantseed)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	recorded, err := app.recordEvents(models, pendingEvent{eventType: eventPlantseedCreated, data: plantseed})
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	err = tx.Commit()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.publishEvents(recorded...)
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/plantseed/%d", plantseed.ID))
-	err = app.writeJSON(w, http.StatusCreated, envelope{"plantseed": plantseed}, headers)
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"plantseed": plantseed}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -53,21 +77,32 @@ func (app *application) showPlantseedHandler(w http.ResponseWriter, r *http.Requ
 	}
 	plantseed, err := app.models.Plantseed.Get(id)
 	if err != nil {
-		switch {
-		case errors.Is(err, data.ErrRecordNotFound):
-			app.notFoundResponse(w, r)
-		default:
-			app.serverErrorResponse(w, r, err)
-		}
+		app.dataErrorResponse(w, r, err)
 		return
 	}
-	err = app.writeJSON(w, http.StatusOK, envelope{"plantseed": plantseed}, nil)
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"plantseed": plantseed}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 
 }
 
+type plantseedDocument struct {
+	Name     string `json:"name"`
+	Family   string `json:"family"`
+	Amount   int32  `json:"amount"`
+	Price    int32  `json:"price"`
+	Language string `json:"language"`
+}
+
+type updatePlantseedInput struct {
+	Name     *string `json:"name"`
+	Family   *string `json:"family"`
+	Amount   *int32  `json:"amount"`
+	Price    *int32  `json:"price"`
+	Language *string `json:"language"`
+}
+
 func (app *application) updatePlantseedHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := app.readIDParam(r)
 	if err != nil {
@@ -76,54 +111,82 @@ func (app *application) updatePlantseedHandler(w http.ResponseWriter, r *http.Re
 	}
 	plantseed, err := app.models.Plantseed.Get(id)
 	if err != nil {
-		switch {
-		case errors.Is(err, data.ErrRecordNotFound):
-			app.notFoundResponse(w, r)
-		default:
-			app.serverErrorResponse(w, r, err)
-		}
+		app.dataErrorResponse(w, r, err)
 		return
 	}
-	var input struct {
-		Name   *string `json:"name"`
-		Family *string `json:"family"`
-		Amount *int32  `json:"amount"`
-		Price  *int32  `json:"price"`
+	previousAmount := plantseed.Amount
+	switch requestMediaType(r) {
+	case mediaTypeMergePatch, mediaTypeJSONPatch:
+		current := plantseedDocument{
+			Name:     plantseed.Name,
+			Family:   plantseed.Family,
+			Amount:   plantseed.Amount,
+			Price:    plantseed.Price,
+			Language: plantseed.Language,
+		}
+		var patched plantseedDocument
+		err = app.readPatch(w, r, current, &patched)
+		if err != nil {
+			app.patchErrorResponse(w, r, err)
+			return
+		}
+		plantseed.Name = patched.Name
+		plantseed.Family = patched.Family
+		plantseed.Amount = patched.Amount
+		plantseed.Price = patched.Price
+		plantseed.Language = patched.Language
+	default:
+		var input updatePlantseedInput
+		err = app.decodeRequest(w, r, &input)
+		if err != nil {
+			app.decodeErrorResponse(w, r, err)
+			return
+		}
+		if input.Name != nil {
+			plantseed.Name = *input.Name
+		}
+		if input.Family != nil {
+			plantseed.Family = *input.Family
+		}
+		if input.Amount != nil {
+			plantseed.Amount = *input.Amount
+		}
+		if input.Price != nil {
+			plantseed.Price = *input.Price
+		}
+		if input.Language != nil {
+			plantseed.Language = *input.Language
+		}
 	}
-	err = app.readJSON(w, r, &input)
-	if err != nil {
-		app.badRequestResponse(w, r, err)
+	v := validator.New()
+	if data.ValidateMovie(v, plantseed); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	if input.Name != nil {
-		plantseed.Name = *input.Name
-	}
-	if input.Family != nil {
-		plantseed.Family = *input.Family
-	}
-	if input.Amount != nil {
-		plantseed.Amount = *input.Amount
+	tx, models, err := app.models.BeginTx(r.Context())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
 	}
-	if input.Price != nil {
-		plantseed.Price = *input.Price
+	defer tx.Rollback()
+	err = models.Plantseed.Update(plantseed)
+	if err != nil {
+		app.dataErrorResponse(w, r, err)
+		return
 	}
-	v := validator.New()
-	if data.ValidateMovie(v, plantseed); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+	recorded, err := app.recordEvents(models, plantseedUpdateEvents(previousAmount, plantseed)...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
 		return
 	}
-	err = app.models.Plantseed.Update(plantseed)
+	err = tx.Commit()
 	if err != nil {
-		switch {
-		case errors.Is(err, data.ErrEditConflict):
-			app.editConflictResponse(w, r)
-		default:
-			app.serverErrorResponse(w, r, err)
-		}
+		app.serverErrorResponse(w, r, err)
 		return
 	}
+	app.publishEvents(recorded...)
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"plantseed": plantseed}, nil)
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"plantseed": plantseed}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -135,32 +198,44 @@ func (app *application) deletePlantseedHandler(w http.ResponseWriter, r *http.Re
 		app.notFoundResponse(w, r)
 		return
 	}
-	err = app.models.Plantseed.Delete(id)
+	tx, models, err := app.models.BeginTx(r.Context())
 	if err != nil {
-		switch {
-		case errors.Is(err, data.ErrRecordNotFound):
-			app.notFoundResponse(w, r)
-		default:
-			app.serverErrorResponse(w, r, err)
-		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	defer tx.Rollback()
+	err = models.Plantseed.Delete(id)
+	if err != nil {
+		app.dataErrorResponse(w, r, err)
 		return
 	}
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "plantseed successfully deleted"}, nil)
+	recorded, err := app.recordEvents(models, pendingEvent{eventType: eventPlantseedDeleted, data: envelope{"id": id}})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.publishEvents(recorded...)
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "plantseed successfully deleted"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
-func (app *application) listPlantseedHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		Name   string
-		Family string
-		Amount int
-		Price  int
-		data.Filters
-	}
-	v := validator.New()
-	qs := r.URL.Query()
+type plantseedQuery struct {
+	Name   string
+	Family string
+	Amount int
+	Price  int
+	data.Filters
+}
+
+func (app *application) readPlantseedQuery(qs url.Values, v *validator.Validator) plantseedQuery {
+	var input plantseedQuery
 	input.Name = app.readString(qs, "name", "")
 	input.Family = app.readString(qs, "family", "")
 	input.Amount = app.readInt(qs, "amount", 1, v)
@@ -169,10 +244,21 @@ func (app *application) listPlantseedHandler(w http.ResponseWriter, r *http.Requ
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
 
-	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.Sort = app.readCSV(qs, "sort", []string{"id"})
 	input.Filters.SortSafelist = []string{"id", "name", "family", "amount", "price", "-id", "-name", "-family", "-amount", "-price"}
+	input.Filters.Cursor = app.readString(qs, "cursor", "")
+	input.Filters.Filter = app.readString(qs, "filter", "")
+	input.Filters.FilterSchema = data.PlantseedFilterSchema
+	input.Filters.Language = app.readString(qs, "lang", "")
 
-	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+	data.ValidateFilters(v, input.Filters)
+	return input
+}
+
+func (app *application) listPlantseedHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	input := app.readPlantseedQuery(r.URL.Query(), v)
+	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
@@ -181,7 +267,8 @@ func (app *application) listPlantseedHandler(w http.ResponseWriter, r *http.Requ
 		app.serverErrorResponse(w, r, err)
 		return
 	}
-	err = app.writeJSON(w, http.StatusOK, envelope{"plantseeds": plantseeds,  "metadata": metadata}, nil)
+	headers := app.paginationLinks(r, &metadata)
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"plantseeds": plantseeds, "metadata": metadata}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -4,26 +4,545 @@ import (
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
+	"golang.assignment2.com/internal/data"
+	"golang.assignment2.com/internal/events"
 )
 
+type queryParam struct {
+	name        string
+	integer     bool
+	description string
+}
+
+type route struct {
+	method        string
+	path          string
+	summary       string
+	permission    string
+	activated     bool
+	authenticated bool
+	idempotent    bool
+	query         []queryParam
+	input         interface{}
+	contentTypes  []string
+	maxBytes      int
+	status        int
+	contentType   string
+	output        interface{}
+	handler       http.HandlerFunc
+}
+
+var plantseedQueryParams = []queryParam{
+	{name: "name", description: "Full-text search on the plantseed name"},
+	{name: "family", description: "Full-text search on the plantseed family"},
+	{name: "amount", integer: true, description: "Exact amount"},
+	{name: "price", integer: true, description: "Exact price"},
+	{name: "page", integer: true, description: "Page number"},
+	{name: "page_size", integer: true, description: "Number of records per page"},
+	{name: "sort", description: "Comma-separated sort keys, prefix with - for descending order"},
+	{name: "cursor", description: "Opaque cursor returned as metadata.next_cursor"},
+	{name: "filter", description: "Filter expression, e.g. name:rose AND price<100"},
+	{name: "lang", description: "Full-text search configuration for name, family and text filters; defaults to each plantseed's own language"},
+}
+
+func (app *application) routeTable() []route {
+	return []route{
+		{
+			method:  http.MethodGet,
+			path:    "/v1/healthcheck",
+			summary: "Report application status",
+			output:  envelope{"status": "", "system_info": map[string]string{}},
+			handler: app.healthcheckHandler,
+		},
+		{
+			method:  http.MethodGet,
+			path:    "/v1/openapi.json",
+			summary: "Describe the API as an OpenAPI 3.1 document",
+			output:  map[string]interface{}{},
+			handler: app.openAPIHandler,
+		},
+		{
+			method:     http.MethodGet,
+			path:       "/v1/plantseed",
+			summary:    "List plantseeds",
+			permission: "plantseed:read",
+			query:      plantseedQueryParams,
+			output:     envelope{"plantseeds": []data.Plantseed{}, "metadata": data.Metadata{}},
+			handler:    app.listPlantseedHandler,
+		},
+		{
+			method:     http.MethodPost,
+			path:       "/v1/plantseed",
+			summary:    "Create a plantseed",
+			permission: "plantseed:write",
+			idempotent: true,
+			input:      createPlantseedInput{},
+			status:     http.StatusCreated,
+			output:     envelope{"plantseed": data.Plantseed{}},
+			handler:    app.createPlantseedHandler,
+		},
+		{
+			method:     http.MethodGet,
+			path:       "/v1/plantseed/:id",
+			summary:    "Show a plantseed",
+			permission: "plantseed:read",
+			output:     envelope{"plantseed": data.Plantseed{}},
+			handler:    app.showPlantseedHandler,
+		},
+		{
+			method:     http.MethodPatch,
+			path:       "/v1/plantseed/:id",
+			summary:    "Update a plantseed",
+			permission: "plantseed:write",
+			input:      updatePlantseedInput{},
+			contentTypes: []string{
+				mediaTypeJSON, mediaTypeMergePatch, mediaTypeJSONPatch, mediaTypeForm, mediaTypeMultipart,
+			},
+			output:  envelope{"plantseed": data.Plantseed{}},
+			handler: app.updatePlantseedHandler,
+		},
+		{
+			method:     http.MethodDelete,
+			path:       "/v1/plantseed/:id",
+			summary:    "Delete a plantseed",
+			permission: "plantseed:write",
+			output:     envelope{"message": ""},
+			handler:    app.deletePlantseedHandler,
+		},
+		{
+			method:      http.MethodGet,
+			path:        "/v1/events",
+			summary:     "Stream catalog change events",
+			permission:  "plantseed:read",
+			contentType: "text/event-stream",
+			output:      events.Event{},
+			handler:     app.streamEventsHandler,
+		},
+		{
+			method:   http.MethodPost,
+			path:     "/v1/users",
+			summary:  "Register a user",
+			input:    registerUserInput{},
+			maxBytes: 4_096,
+			status:   http.StatusAccepted,
+			output:   envelope{"user": data.User{}},
+			handler:  app.registerUserHandler,
+		},
+		{
+			method:   http.MethodPut,
+			path:     "/v1/users/activated",
+			summary:  "Activate a user",
+			input:    activateUserInput{},
+			maxBytes: 4_096,
+			output:   envelope{"user": data.User{}},
+			handler:  app.activateUserHandler,
+		},
+		{
+			method:   http.MethodPut,
+			path:     "/v1/users/password",
+			summary:  "Set a new password with a password reset token",
+			input:    updateUserPasswordInput{},
+			maxBytes: 4_096,
+			output:   envelope{"message": ""},
+			handler:  app.updateUserPasswordHandler,
+		},
+		{
+			method:        http.MethodGet,
+			path:          "/v1/users/me",
+			summary:       "Show the current user with their permissions",
+			authenticated: true,
+			output:        envelope{"user": data.User{}, "permissions": data.Permissions{}, "version": 0},
+			handler:       app.showCurrentUserHandler,
+		},
+		{
+			method:        http.MethodPatch,
+			path:          "/v1/users/me",
+			summary:       "Update the current user",
+			authenticated: true,
+			input:         updateCurrentUserInput{},
+			output:        envelope{"user": data.User{}, "permissions": data.Permissions{}, "version": 0},
+			handler:       app.updateCurrentUserHandler,
+		},
+		{
+			method:        http.MethodDelete,
+			path:          "/v1/users/me",
+			summary:       "Delete the current user after confirming their password",
+			authenticated: true,
+			input:         deleteCurrentUserInput{},
+			maxBytes:      4_096,
+			output:        envelope{"message": ""},
+			handler:       app.deleteCurrentUserHandler,
+		},
+		{
+			method:        http.MethodPut,
+			path:          "/v1/users/me/password",
+			summary:       "Change the current user's password",
+			authenticated: true,
+			input:         updateCurrentUserPasswordInput{},
+			maxBytes:      4_096,
+			output:        envelope{"message": ""},
+			handler:       app.updateCurrentUserPasswordHandler,
+		},
+		{
+			method:        http.MethodPost,
+			path:          "/v1/users/me/email",
+			summary:       "Request a change of the current user's email address",
+			authenticated: true,
+			input:         createEmailChangeInput{},
+			maxBytes:      4_096,
+			status:        http.StatusAccepted,
+			output:        envelope{"message": ""},
+			handler:       app.createEmailChangeHandler,
+		},
+		{
+			method:        http.MethodGet,
+			path:          "/v1/users/me/2fa",
+			summary:       "Show the current user's two-factor authentication status",
+			authenticated: true,
+			output:        envelope{"enabled": false, "recovery_codes_remaining": 0},
+			handler:       app.showTwoFactorHandler,
+		},
+		{
+			method:        http.MethodPost,
+			path:          "/v1/users/me/2fa",
+			summary:       "Start two-factor authentication enrollment",
+			authenticated: true,
+			status:        http.StatusCreated,
+			output:        envelope{"secret": "", "otpauth_uri": ""},
+			handler:       app.enrollTwoFactorHandler,
+		},
+		{
+			method:        http.MethodPost,
+			path:          "/v1/users/me/2fa/confirm",
+			summary:       "Confirm two-factor authentication enrollment and receive recovery codes",
+			authenticated: true,
+			input:         confirmTwoFactorInput{},
+			maxBytes:      4_096,
+			output:        envelope{"recovery_codes": []string{}},
+			handler:       app.confirmTwoFactorHandler,
+		},
+		{
+			method:        http.MethodDelete,
+			path:          "/v1/users/me/2fa",
+			summary:       "Disable two-factor authentication",
+			authenticated: true,
+			input:         disableTwoFactorInput{},
+			maxBytes:      4_096,
+			output:        envelope{"message": ""},
+			handler:       app.disableTwoFactorHandler,
+		},
+		{
+			method:   http.MethodPut,
+			path:     "/v1/users/email",
+			summary:  "Confirm an email address change",
+			input:    confirmEmailChangeInput{},
+			maxBytes: 4_096,
+			output:   envelope{"user": data.User{}},
+			handler:  app.confirmEmailChangeHandler,
+		},
+		{
+			method:   http.MethodPut,
+			path:     "/v1/users/email/cancel",
+			summary:  "Cancel a pending email address change from the current address",
+			input:    cancelEmailChangeInput{},
+			maxBytes: 4_096,
+			output:   envelope{"message": ""},
+			handler:  app.cancelEmailChangeHandler,
+		},
+		{
+			method:    http.MethodGet,
+			path:      "/v1/users/me/saved-searches",
+			summary:   "List saved searches",
+			activated: true,
+			output:    envelope{"saved_searches": []data.SavedSearch{}},
+			handler:   app.listSavedSearchesHandler,
+		},
+		{
+			method:     http.MethodPost,
+			path:       "/v1/users/me/saved-searches",
+			summary:    "Create a saved search",
+			activated:  true,
+			idempotent: true,
+			input:      createSavedSearchInput{},
+			status:     http.StatusCreated,
+			output:     envelope{"saved_search": data.SavedSearch{}},
+			handler:    app.createSavedSearchHandler,
+		},
+		{
+			method:    http.MethodDelete,
+			path:      "/v1/users/me/saved-searches/:id",
+			summary:   "Delete a saved search",
+			activated: true,
+			output:    envelope{"message": ""},
+			handler:   app.deleteSavedSearchHandler,
+		},
+		{
+			method:     http.MethodGet,
+			path:       "/v1/webhooks",
+			summary:    "List webhook subscriptions",
+			permission: "webhooks:manage",
+			output:     envelope{"webhooks": []data.Webhook{}},
+			handler:    app.listWebhooksHandler,
+		},
+		{
+			method:     http.MethodPost,
+			path:       "/v1/webhooks",
+			summary:    "Create a webhook subscription",
+			permission: "webhooks:manage",
+			idempotent: true,
+			input:      createWebhookInput{},
+			status:     http.StatusCreated,
+			output:     envelope{"webhook": data.Webhook{}, "secret": ""},
+			handler:    app.createWebhookHandler,
+		},
+		{
+			method:     http.MethodGet,
+			path:       "/v1/webhooks/:id",
+			summary:    "Show a webhook subscription",
+			permission: "webhooks:manage",
+			output:     envelope{"webhook": data.Webhook{}},
+			handler:    app.showWebhookHandler,
+		},
+		{
+			method:     http.MethodPatch,
+			path:       "/v1/webhooks/:id",
+			summary:    "Update a webhook subscription",
+			permission: "webhooks:manage",
+			input:      updateWebhookInput{},
+			output:     envelope{"webhook": data.Webhook{}},
+			handler:    app.updateWebhookHandler,
+		},
+		{
+			method:     http.MethodDelete,
+			path:       "/v1/webhooks/:id",
+			summary:    "Delete a webhook subscription",
+			permission: "webhooks:manage",
+			output:     envelope{"message": ""},
+			handler:    app.deleteWebhookHandler,
+		},
+		{
+			method:     http.MethodGet,
+			path:       "/v1/webhooks/:id/deliveries",
+			summary:    "List deliveries of a webhook subscription",
+			permission: "webhooks:manage",
+			query: []queryParam{
+				{name: "status", description: "Delivery status: pending, succeeded or dead"},
+				{name: "page", integer: true, description: "Page number"},
+				{name: "page_size", integer: true, description: "Number of records per page"},
+				{name: "sort", description: "Comma-separated sort keys, prefix with - for descending order"},
+			},
+			output:  envelope{"deliveries": []data.WebhookDelivery{}, "metadata": data.Metadata{}},
+			handler: app.listWebhookDeliveriesHandler,
+		},
+		{
+			method:     http.MethodGet,
+			path:       "/v1/webhooks/:id/deliveries/:delivery_id/attempts",
+			summary:    "List the delivery attempts made for a webhook delivery",
+			permission: "webhooks:manage",
+			output:     envelope{"attempts": []data.WebhookDeliveryAttempt{}},
+			handler:    app.listWebhookDeliveryAttemptsHandler,
+		},
+		{
+			method:     http.MethodPost,
+			path:       "/v1/webhooks/:id/deliveries/:delivery_id/redeliver",
+			summary:    "Queue a webhook delivery to be sent again",
+			permission: "webhooks:manage",
+			status:     http.StatusAccepted,
+			output:     envelope{"delivery": data.WebhookDelivery{}},
+			handler:    app.redeliverWebhookHandler,
+		},
+		{
+			method:     http.MethodGet,
+			path:       "/v1/admin/users",
+			summary:    "List and search users",
+			permission: "users:admin",
+			query: []queryParam{
+				{name: "q", description: "Case-insensitive search on name and email"},
+				{name: "activated", description: "Only users with this activation state, true or false"},
+				{name: "page", integer: true, description: "Page number"},
+				{name: "page_size", integer: true, description: "Number of records per page"},
+				{name: "sort", description: "Comma-separated sort keys, prefix with - for descending order"},
+			},
+			output:  envelope{"users": []data.User{}, "metadata": data.Metadata{}},
+			handler: app.listUsersHandler,
+		},
+		{
+			method:     http.MethodGet,
+			path:       "/v1/admin/users/:id",
+			summary:    "Show a user with their permissions",
+			permission: "users:admin",
+			output:     envelope{"user": data.User{}, "permissions": data.Permissions{}, "version": 0},
+			handler:    app.showUserHandler,
+		},
+		{
+			method:     http.MethodPatch,
+			path:       "/v1/admin/users/:id",
+			summary:    "Activate or deactivate a user",
+			permission: "users:admin",
+			input:      updateUserInput{},
+			output:     envelope{"user": data.User{}, "permissions": data.Permissions{}, "version": 0},
+			handler:    app.updateUserHandler,
+		},
+		{
+			method:     http.MethodPost,
+			path:       "/v1/admin/users/:id/password-reset",
+			summary:    "Invalidate a user's password and email them a password reset token",
+			permission: "users:admin",
+			status:     http.StatusAccepted,
+			output:     envelope{"message": ""},
+			handler:    app.resetUserPasswordHandler,
+		},
+		{
+			method:     http.MethodPost,
+			path:       "/v1/admin/users/:id/permissions",
+			summary:    "Grant permissions to a user",
+			permission: "users:admin",
+			input:      grantPermissionsInput{},
+			output:     envelope{"user": data.User{}, "permissions": data.Permissions{}, "version": 0},
+			handler:    app.grantPermissionsHandler,
+		},
+		{
+			method:     http.MethodDelete,
+			path:       "/v1/admin/users/:id/permissions/:code",
+			summary:    "Revoke a permission from a user",
+			permission: "users:admin",
+			output:     envelope{"user": data.User{}, "permissions": data.Permissions{}, "version": 0},
+			handler:    app.revokePermissionHandler,
+		},
+		{
+			method:     http.MethodDelete,
+			path:       "/v1/admin/users/:id/lockout",
+			summary:    "Clear a login lockout on a user's email address",
+			permission: "users:admin",
+			output:     envelope{"message": ""},
+			handler:    app.clearUserLockoutHandler,
+		},
+		{
+			method:     http.MethodDelete,
+			path:       "/v1/admin/lockouts/ip/:ip",
+			summary:    "Clear a login lockout on an IP address",
+			permission: "users:admin",
+			output:     envelope{"message": ""},
+			handler:    app.clearIPLockoutHandler,
+		},
+		{
+			method:       http.MethodPost,
+			path:         "/v1/batch",
+			summary:      "Run create, update and delete operations in one transaction",
+			activated:    true,
+			idempotent:   true,
+			input:        batchInput{},
+			contentTypes: []string{mediaTypeJSON},
+			maxBytes:     4_194_304,
+			output:       envelope{"committed": false, "results": []batchResult{}},
+			handler:      app.batchHandler,
+		},
+		{
+			method:   http.MethodPost,
+			path:     "/v1/tokens/authentication",
+			summary:  "Create an authentication token, completing a two-factor challenge when enrolled",
+			input:    createAuthenticationTokenInput{},
+			maxBytes: 4_096,
+			status:   http.StatusCreated,
+			output:   envelope{"authentication_token": data.Token{}, "refresh_token": data.Token{}},
+			handler:  app.createAuthenticationTokenHandler,
+		},
+		{
+			method:   http.MethodPost,
+			path:     "/v1/tokens/refresh",
+			summary:  "Exchange a refresh token for new authentication and refresh tokens",
+			input:    refreshTokenInput{},
+			maxBytes: 4_096,
+			status:   http.StatusCreated,
+			output:   envelope{"authentication_token": data.Token{}, "refresh_token": data.Token{}},
+			handler:  app.refreshTokenHandler,
+		},
+		{
+			method:        http.MethodDelete,
+			path:          "/v1/tokens/authentication",
+			summary:       "Revoke the presented authentication token",
+			authenticated: true,
+			output:        envelope{"message": ""},
+			handler:       app.deleteAuthenticationTokenHandler,
+		},
+		{
+			method:        http.MethodGet,
+			path:          "/v1/tokens",
+			summary:       "List the current user's active sessions",
+			authenticated: true,
+			output:        envelope{"sessions": []data.Session{}},
+			handler:       app.listSessionsHandler,
+		},
+		{
+			method:        http.MethodDelete,
+			path:          "/v1/tokens/sessions",
+			summary:       "Revoke all sessions except the current one",
+			authenticated: true,
+			output:        envelope{"revoked": 0},
+			handler:       app.deleteOtherSessionsHandler,
+		},
+		{
+			method:        http.MethodDelete,
+			path:          "/v1/tokens/sessions/:id",
+			summary:       "Revoke a session",
+			authenticated: true,
+			output:        envelope{"message": ""},
+			handler:       app.deleteSessionHandler,
+		},
+		{
+			method:   http.MethodPost,
+			path:     "/v1/tokens/activation",
+			summary:  "Resend the activation email with a fresh token",
+			input:    createActivationTokenInput{},
+			maxBytes: 4_096,
+			status:   http.StatusAccepted,
+			output:   envelope{"message": ""},
+			handler:  app.createActivationTokenHandler,
+		},
+		{
+			method:   http.MethodPost,
+			path:     "/v1/tokens/password-reset",
+			summary:  "Email a password reset token",
+			input:    createPasswordResetTokenInput{},
+			maxBytes: 4_096,
+			status:   http.StatusAccepted,
+			output:   envelope{"message": ""},
+			handler:  app.createPasswordResetTokenHandler,
+		},
+	}
+}
+
+func (app *application) routeHandler(rt route) http.HandlerFunc {
+	handler := rt.handler
+	if rt.idempotent {
+		handler = app.idempotent(handler)
+	}
+	if app.config.openapi.validate {
+		handler = app.validateRequest(rt, handler)
+	}
+	switch {
+	case rt.permission != "":
+		handler = app.requirePermission(rt.permission, handler)
+	case rt.activated:
+		handler = app.requireActivatedUser(handler)
+	case rt.authenticated:
+		handler = app.requireAuthenticatedUser(app.loadUser(handler))
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		handler(w, app.contextSetRoute(r, &rt))
+	}
+}
+
 func (app *application) routes() http.Handler {
 	router := httprouter.New()
 	router.NotFound = http.HandlerFunc(app.notFoundResponse)
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
 
-	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
-
-	router.HandlerFunc(http.MethodGet, "/v1/plantseed", app.requirePermission("plantseed:read", app.listPlantseedHandler))
-	router.HandlerFunc(http.MethodPost, "/v1/plantseed", app.requirePermission("plantseed:write", app.createPlantseedHandler))
-	router.HandlerFunc(http.MethodGet, "/v1/plantseed/:id", app.requirePermission("plantseed:read", app.showPlantseedHandler))
-	router.HandlerFunc(http.MethodPatch, "/v1/plantseed/:id", app.requirePermission("plantseed:write", app.updatePlantseedHandler))
-	router.HandlerFunc(http.MethodDelete, "/v1/plantseed/:id", app.requirePermission("plantseed:write", app.deletePlantseedHandler))
+	table := app.routeTable()
+	app.openapi = newOpenAPIDocument(table)
+	for _, rt := range table {
+		router.HandlerFunc(rt.method, rt.path, app.routeHandler(rt))
+	}
 
-	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
-	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
-
-	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
-
-	return app.recoverPanic(app.enableCORS(app.rateLimit(app.authenticate(router))))
+	return app.requestID(app.recoverPanic(app.enableCORS(app.compress(app.negotiate(app.rateLimit(app.authenticate(router)))))))
 }
-
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.assignment2.com/internal/data"
+	"golang.assignment2.com/internal/validator"
+)
+
+const savedSearchDigestLimit = 20
+
+func (app *application) newSavedSearch(v *validator.Validator, userID int64, name, query string) *data.SavedSearch {
+	search := &data.SavedSearch{
+		UserID: userID,
+		Name:   name,
+	}
+	qs, err := url.ParseQuery(strings.TrimPrefix(query, "?"))
+	if err != nil {
+		v.AddError("query", "must be a valid query string")
+		return search
+	}
+	for _, key := range []string{"page", "page_size", "cursor"} {
+		qs.Del(key)
+	}
+	qv := validator.New()
+	app.readPlantseedQuery(qs, qv)
+	for key, message := range qv.Errors {
+		v.AddError("query."+key, message)
+	}
+	search.Query = qs.Encode()
+	data.ValidateSavedSearch(v, search)
+	return search
+}
+
+type createSavedSearchInput struct {
+	Name  string `json:"name"`
+	Query string `json:"query"`
+}
+
+func (app *application) createSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	var input createSavedSearchInput
+	err := app.decodeRequest(w, r, &input)
+	if err != nil {
+		app.decodeErrorResponse(w, r, err)
+		return
+	}
+	user := app.contextGetUser(r)
+	v := validator.New()
+	search := app.newSavedSearch(v, user.ID, input.Name, input.Query)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	count, err := app.models.SavedSearches.CountForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if count >= data.MaxSavedSearchesPerUser {
+		v.AddError("name", "maximum number of saved searches reached")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.SavedSearches.Insert(search)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"saved_search": search}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listSavedSearchesHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	searches, err := app.models.SavedSearches.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"saved_searches": searches}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	user := app.contextGetUser(r)
+	err = app.models.SavedSearches.Delete(id, user.ID)
+	if err != nil {
+		app.dataErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "saved search successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+type savedSearchMatches struct {
+	Search     *data.SavedSearch
+	Plantseeds []*data.Plantseed
+}
+
+func (app *application) notifySavedSearches() {
+	subscribers, err := app.models.SavedSearches.GetSubscribers()
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+	for _, subscriber := range subscribers {
+		var digest []savedSearchMatches
+		for _, search := range subscriber.Searches {
+			qs, err := url.ParseQuery(search.Query)
+			if err != nil {
+				app.logger.PrintError(err, map[string]string{"saved_search_id": strconv.FormatInt(search.ID, 10)})
+				continue
+			}
+			v := validator.New()
+			input := app.readPlantseedQuery(qs, v)
+			if !v.Valid() {
+				app.logger.PrintError(errors.New("invalid saved search query"), map[string]string{"saved_search_id": strconv.FormatInt(search.ID, 10)})
+				continue
+			}
+			plantseeds, err := app.models.Plantseed.GetNewMatches(input.Name, input.Family, input.Filters, search.ID, search.LastSeenAt, savedSearchDigestLimit)
+			if err != nil {
+				app.logger.PrintError(err, map[string]string{"saved_search_id": strconv.FormatInt(search.ID, 10)})
+				continue
+			}
+			if len(plantseeds) > 0 {
+				digest = append(digest, savedSearchMatches{Search: search, Plantseeds: plantseeds})
+			}
+		}
+		if len(digest) == 0 {
+			continue
+		}
+		mailData := map[string]interface{}{
+			"name":    subscriber.Name,
+			"matches": digest,
+		}
+		err = app.mailer.Send(subscriber.Email, "saved_search_digest.tmpl", mailData)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"user_id": strconv.FormatInt(subscriber.UserID, 10)})
+			continue
+		}
+		for _, matches := range digest {
+			err = app.models.SavedSearches.UpdateWatermark(matches.Search, matches.Plantseeds)
+			if err != nil && !errors.Is(err, data.ErrEditConflict) {
+				app.logger.PrintError(err, map[string]string{"saved_search_id": strconv.FormatInt(matches.Search.ID, 10)})
+			}
+		}
+	}
+	app.logger.PrintInfo("saved search notifications processed", map[string]string{
+		"subscribers": strconv.Itoa(len(subscribers)),
+	})
+}
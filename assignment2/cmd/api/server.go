@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 )
@@ -19,6 +20,9 @@ func (app *application) serve() error {
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
 	}
+	srv.RegisterOnShutdown(app.events.Close)
+	ctx, stopJobs := context.WithCancel(context.Background())
+	app.startJobs(ctx)
 	shutdownError := make(chan error)
 	go func() {
 		quit := make(chan os.Signal, 1)
@@ -36,6 +40,7 @@ func (app *application) serve() error {
 		app.logger.PrintInfo("completing background tasks", map[string]string{
 			"addr": srv.Addr,
 		})
+		stopJobs()
 		app.wg.Wait()
 		shutdownError <- nil
 	}()
@@ -56,3 +61,31 @@ func (app *application) serve() error {
 	})
 	return nil
 }
+
+func (app *application) startJobs(ctx context.Context) {
+	app.runPeriodically(ctx, time.Hour, app.deleteExpiredIdempotencyKeys)
+	app.runPeriodically(ctx, app.config.login.window, app.deleteExpiredLoginAttempts)
+	if app.jwt != nil {
+		app.runPeriodically(ctx, time.Minute, app.denylist.Prune)
+	}
+	if app.config.activation.resendInterval > 0 {
+		app.runPeriodically(ctx, app.config.activation.resendInterval, app.activationThrottle.prune)
+	}
+	if app.config.savedSearches.interval > 0 {
+		app.runPeriodically(ctx, app.config.savedSearches.interval, app.notifySavedSearches)
+	}
+	if app.config.webhooks.interval > 0 {
+		app.runPeriodically(ctx, app.config.webhooks.interval, app.deliverWebhooks)
+	}
+}
+
+func (app *application) deleteExpiredIdempotencyKeys() {
+	deleted, err := app.models.Idempotency.DeleteExpired()
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+	app.logger.PrintInfo("expired idempotency keys deleted", map[string]string{
+		"deleted": strconv.FormatInt(deleted, 10),
+	})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.assignment2.com/internal/data"
+	"golang.assignment2.com/internal/events"
+	"golang.assignment2.com/internal/jsonlog"
+	"golang.assignment2.com/internal/jwt"
+	"golang.assignment2.com/internal/mailer"
+	"golang.assignment2.com/internal/testdb"
+)
+
+const testPassword = "pa55word1234"
+
+func newTestApplication(t *testing.T) *application {
+	app := &application{
+		logger:             jsonlog.New(io.Discard, jsonlog.LevelOff),
+		models:             data.NewModels(testdb.Open(t)),
+		mailer:             mailer.New("127.0.0.1", 1, "", "", "Greenlight <no-reply@example.com>"),
+		events:             events.New(16),
+		activationThrottle: newThrottle(time.Minute),
+		denylist:           jwt.NewDenylist(15 * time.Minute),
+	}
+	app.config.problems.typeBase = "about:blank"
+	app.config.login.window = 15 * time.Minute
+	app.config.login.emailThreshold = 5
+	app.config.login.ipThreshold = 20
+	app.config.login.lockout = 15 * time.Minute
+	app.config.tokens.accessTTL = 15 * time.Minute
+	app.config.tokens.refreshTTL = 24 * time.Hour
+	t.Cleanup(app.wg.Wait)
+	return app
+}
+
+type testServer struct {
+	*httptest.Server
+}
+
+func newTestServer(t *testing.T, app *application) *testServer {
+	ts := httptest.NewServer(app.routes())
+	t.Cleanup(ts.Close)
+	return &testServer{ts}
+}
+
+func (ts *testServer) do(t *testing.T, method, path, token string, body interface{}) (int, map[string]interface{}) {
+	t.Helper()
+	var payload io.Reader
+	if body != nil {
+		js, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		payload = bytes.NewReader(js)
+	}
+	req, err := http.NewRequest(method, ts.URL+path, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var env map[string]interface{}
+	err = json.NewDecoder(res.Body).Decode(&env)
+	if err != nil && err != io.EOF {
+		t.Fatal(err)
+	}
+	return res.StatusCode, env
+}
+
+func (ts *testServer) login(t *testing.T, email, password string) (string, string) {
+	t.Helper()
+	status, env := ts.do(t, http.MethodPost, "/v1/tokens/authentication", "", envelope{"email": email, "password": password})
+	if status != http.StatusCreated {
+		t.Fatalf("login: got status %d; want %d: %v", status, http.StatusCreated, env)
+	}
+	return tokenField(t, env, "authentication_token"), tokenField(t, env, "refresh_token")
+}
+
+func tokenField(t *testing.T, env map[string]interface{}, name string) string {
+	t.Helper()
+	token, ok := env[name].(map[string]interface{})
+	if !ok {
+		t.Fatalf("response has no %s: %v", name, env)
+	}
+	plaintext, _ := token["token"].(string)
+	return plaintext
+}
+
+func insertTestUser(t *testing.T, app *application, email string) *data.User {
+	t.Helper()
+	user := &data.User{Name: "Test User", Email: email, Activated: true}
+	err := user.Password.Set(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.models.Users.Insert(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
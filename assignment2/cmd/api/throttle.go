@@ -0,0 +1,43 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+type throttle struct {
+	mu       sync.Mutex
+	interval time.Duration
+	last     map[string]time.Time
+}
+
+func newThrottle(interval time.Duration) *throttle {
+	return &throttle{
+		interval: interval,
+		last:     make(map[string]time.Time),
+	}
+}
+
+func (t *throttle) Allow(key string) bool {
+	if t.interval <= 0 {
+		return true
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	if last, ok := t.last[key]; ok && now.Sub(last) < t.interval {
+		return false
+	}
+	t.last[key] = now
+	return true
+}
+
+func (t *throttle) prune() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key, last := range t.last {
+		if time.Since(last) >= t.interval {
+			delete(t.last, key)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestThrottle(t *testing.T) {
+	th := newThrottle(time.Hour)
+	if !th.Allow("alice@example.com") {
+		t.Fatal("first request was throttled")
+	}
+	if th.Allow("alice@example.com") {
+		t.Error("second request within the interval was allowed")
+	}
+	if !th.Allow("bob@example.com") {
+		t.Error("request for a different key was throttled")
+	}
+	th.last["alice@example.com"] = time.Now().Add(-2 * time.Hour)
+	if !th.Allow("alice@example.com") {
+		t.Error("request after the interval was throttled")
+	}
+}
+
+func TestThrottleDisabled(t *testing.T) {
+	th := newThrottle(0)
+	for i := 0; i < 3; i++ {
+		if !th.Allow("alice@example.com") {
+			t.Fatal("disabled throttle rejected a request")
+		}
+	}
+}
+
+func TestThrottlePrune(t *testing.T) {
+	th := newThrottle(time.Hour)
+	th.Allow("fresh")
+	th.last["stale"] = time.Now().Add(-2 * time.Hour)
+	th.prune()
+	if _, ok := th.last["stale"]; ok {
+		t.Error("stale key was not pruned")
+	}
+	if _, ok := th.last["fresh"]; !ok {
+		t.Error("fresh key was pruned")
+	}
+}
@@ -3,20 +3,30 @@ package main
 import (
 	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"golang.assignment2.com/internal/data"
 	"golang.assignment2.com/internal/validator"
 )
 
+type createAuthenticationTokenInput struct {
+	Email          string `json:"email"`
+	Password       string `json:"password"`
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+}
+
 func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
-	err := app.readJSON(w, r, &input)
+	var input createAuthenticationTokenInput
+	err := app.decodeRequest(w, r, &input)
 	if err != nil {
-		app.badRequestResponse(w, r, err)
+		app.decodeErrorResponse(w, r, err)
+		return
+	}
+	if input.ChallengeToken != "" {
+		app.completeTwoFactorLogin(w, r, input)
 		return
 	}
 	v := validator.New()
@@ -26,10 +36,15 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
+	reserved, ok := app.reserveLogin(w, r, input.Email)
+	if !ok {
+		return
+	}
 	user, err := app.models.Users.GetByEmail(input.Email)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
+			app.recordLoginFailure(r, input.Email, reserved)
 			app.invalidCredentialsResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
@@ -42,15 +57,350 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 	if !match {
+		app.recordLoginFailure(r, input.Email, reserved)
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+	if user.Disabled() {
+		app.releaseLogin(r, reserved, false)
+		app.accountDisabledResponse(w, r)
+		return
+	}
+	tf, err := app.models.TwoFactor.Get(user.ID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if tf != nil && tf.Confirmed {
+		app.releaseLogin(r, reserved, false)
+		err = app.models.Tokens.DeleteAllForUser(data.ScopeTwoFactor, user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		challenge, err := app.models.Tokens.New(user.ID, 5*time.Minute, data.ScopeTwoFactor)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		err = app.writeResponse(w, r, http.StatusAccepted, envelope{"two_factor_required": true, "challenge_token": challenge}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.issueLoginSession(w, r, user, reserved)
+}
+
+func (app *application) completeTwoFactorLogin(w http.ResponseWriter, r *http.Request, input createAuthenticationTokenInput) {
+	v := validator.New()
+	v.Check(len(input.ChallengeToken) == 26, "challenge_token", "must be 26 bytes long")
+	v.Check(input.Code != "", "code", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user, err := app.models.Users.GetForToken(data.ScopeTwoFactor, input.ChallengeToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidCredentialsResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if user.Disabled() {
+		app.accountDisabledResponse(w, r)
+		return
+	}
+	tf, err := app.models.TwoFactor.Get(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidCredentialsResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	reserved, ok := app.reserveLogin(w, r, user.Email)
+	if !ok {
+		return
+	}
+	ok, err = app.verifySecondFactor(app.models, tf, input.Code)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		app.recordLoginFailure(r, user.Email, reserved)
 		app.invalidCredentialsResponse(w, r)
 		return
 	}
-	token, err := app.models.Tokens.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	err = app.models.Tokens.DeleteAllForUser(data.ScopeTwoFactor, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.issueLoginSession(w, r, user, reserved)
+}
+
+func (app *application) issueLoginSession(w http.ResponseWriter, r *http.Request, user *data.User, reserved []loginReservation) {
+	app.releaseLogin(r, reserved, true)
+	access, refresh, err := app.issueSession(app.models, r, user.ID, 0)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"authentication_token": access, "refresh_token": refresh}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+type createPasswordResetTokenInput struct {
+	Email string `json:"email"`
+}
+
+func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input createPasswordResetTokenInput
+	err := app.decodeRequest(w, r, &input)
+	if err != nil {
+		app.decodeErrorResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	app.background(func() {
+		user, err := app.models.Users.GetByEmail(input.Email)
+		if err != nil {
+			if !errors.Is(err, data.ErrRecordNotFound) {
+				app.logger.PrintError(err, nil)
+			}
+			return
+		}
+		err = app.models.Tokens.DeleteAllForUser(data.ScopePasswordReset, user.ID)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+			return
+		}
+		token, err := app.models.Tokens.New(user.ID, 45*time.Minute, data.ScopePasswordReset)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+			return
+		}
+		data := map[string]interface{}{
+			"passwordResetToken": token.Plaintext,
+		}
+		err = app.mailer.Send(user.Email, "password_reset.tmpl", data)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+	env := envelope{"message": "an email will be sent to you containing password reset instructions"}
+	err = app.writeResponse(w, r, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+type createActivationTokenInput struct {
+	Email string `json:"email"`
+}
+
+func (app *application) createActivationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input createActivationTokenInput
+	err := app.decodeRequest(w, r, &input)
+	if err != nil {
+		app.decodeErrorResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if !app.activationThrottle.Allow(strings.ToLower(input.Email)) {
+		app.rateLimitExceededResponse(w, r)
+		return
+	}
+	app.background(func() {
+		user, err := app.models.Users.GetByEmail(input.Email)
+		if err != nil {
+			if !errors.Is(err, data.ErrRecordNotFound) {
+				app.logger.PrintError(err, nil)
+			}
+			return
+		}
+		if user.Activated || user.Disabled() {
+			return
+		}
+		err = app.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+			return
+		}
+		token, err := app.models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+			return
+		}
+		data := map[string]interface{}{
+			"activationToken": token.Plaintext,
+			"userID":          user.ID,
+		}
+		err = app.mailer.Send(user.Email, "user_welcome.tmpl", data)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+	env := envelope{"message": "an email will be sent to you containing activation instructions"}
+	err = app.writeResponse(w, r, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	family := app.contextGetSession(r).family
+	err := app.models.Tokens.DeleteSession(family, app.contextGetUser(r).ID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.revokeSessions(family)
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "authentication token successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	sessions, err := app.models.Tokens.GetSessions(app.contextGetUser(r).ID, app.contextGetSession(r).family)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"sessions": sessions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = app.models.Tokens.DeleteSession(id, app.contextGetUser(r).ID)
+	if err != nil {
+		app.dataErrorResponse(w, r, err)
+		return
+	}
+	app.revokeSessions(id)
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "session successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteOtherSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	families, err := app.models.Tokens.DeleteOtherSessions(app.contextGetUser(r).ID, app.contextGetSession(r).family)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.revokeSessions(families...)
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"revoked": len(families)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+type refreshTokenInput struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (app *application) refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input refreshTokenInput
+	err := app.decodeRequest(w, r, &input)
+	if err != nil {
+		app.decodeErrorResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	v.Check(input.RefreshToken != "", "refresh_token", "must be provided")
+	v.Check(len(input.RefreshToken) == 26, "refresh_token", "must be 26 bytes long")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	tx, models, err := app.models.BeginTx(r.Context())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	defer tx.Rollback()
+	token, used, err := models.Tokens.GetRefresh(input.RefreshToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("refresh_token", "invalid or expired refresh token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if used {
+		err = models.Tokens.DeleteFamily(token.Family)
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		app.revokeSessions(token.Family)
+		app.logger.PrintInfo("refresh token reused, session revoked", map[string]string{
+			"user_id": strconv.FormatInt(token.UserID, 10),
+			"family":  strconv.FormatInt(token.Family, 10),
+			"ip":      clientIP(r),
+		})
+		v.AddError("refresh_token", "invalid or expired refresh token")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user, err := models.Users.Get(token.UserID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if user.Disabled() {
+		app.accountDisabledResponse(w, r)
+		return
+	}
+	err = models.Tokens.MarkUsed(token)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	access, refresh, err := app.issueSession(models, r, token.UserID, token.Family)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = tx.Commit()
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
-	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"authentication_token": access, "refresh_token": refresh}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
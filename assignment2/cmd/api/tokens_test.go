@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app)
+	insertTestUser(t, app, "alice@example.com")
+	_, refresh := ts.login(t, "alice@example.com", testPassword)
+
+	status, env := ts.do(t, http.MethodPost, "/v1/tokens/refresh", "", envelope{"refresh_token": refresh})
+	if status != http.StatusCreated {
+		t.Fatalf("refresh: got status %d; want %d", status, http.StatusCreated)
+	}
+	access, rotated := tokenField(t, env, "authentication_token"), tokenField(t, env, "refresh_token")
+
+	status, _ = ts.do(t, http.MethodPost, "/v1/tokens/refresh", "", envelope{"refresh_token": refresh})
+	if status != http.StatusUnprocessableEntity {
+		t.Fatalf("reused refresh: got status %d; want %d", status, http.StatusUnprocessableEntity)
+	}
+	status, _ = ts.do(t, http.MethodPost, "/v1/tokens/refresh", "", envelope{"refresh_token": rotated})
+	if status != http.StatusUnprocessableEntity {
+		t.Errorf("rotated refresh after reuse: got status %d; want %d", status, http.StatusUnprocessableEntity)
+	}
+	status, _ = ts.do(t, http.MethodGet, "/v1/users/me", access, nil)
+	if status != http.StatusUnauthorized {
+		t.Errorf("access token after reuse: got status %d; want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestConcurrentRefresh(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app)
+	insertTestUser(t, app, "alice@example.com")
+	_, refresh := ts.login(t, "alice@example.com", testPassword)
+
+	statuses := make([]int, 2)
+	var wg sync.WaitGroup
+	for i := range statuses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			statuses[i], _ = ts.do(t, http.MethodPost, "/v1/tokens/refresh", "", envelope{"refresh_token": refresh})
+		}(i)
+	}
+	wg.Wait()
+	sort.Ints(statuses)
+	if statuses[0] != http.StatusCreated || statuses[1] != http.StatusUnprocessableEntity {
+		t.Errorf("got statuses %v; want one %d and one %d", statuses, http.StatusCreated, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestLogoutKeepsOtherSessions(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app)
+	insertTestUser(t, app, "alice@example.com")
+	first, _ := ts.login(t, "alice@example.com", testPassword)
+	second, secondRefresh := ts.login(t, "alice@example.com", testPassword)
+
+	status, _ := ts.do(t, http.MethodDelete, "/v1/tokens/authentication", first, nil)
+	if status != http.StatusOK {
+		t.Fatalf("logout: got status %d; want %d", status, http.StatusOK)
+	}
+	status, _ = ts.do(t, http.MethodGet, "/v1/users/me", first, nil)
+	if status != http.StatusUnauthorized {
+		t.Errorf("logged out session: got status %d; want %d", status, http.StatusUnauthorized)
+	}
+	status, _ = ts.do(t, http.MethodGet, "/v1/users/me", second, nil)
+	if status != http.StatusOK {
+		t.Errorf("other session: got status %d; want %d", status, http.StatusOK)
+	}
+	status, _ = ts.do(t, http.MethodPost, "/v1/tokens/refresh", "", envelope{"refresh_token": secondRefresh})
+	if status != http.StatusCreated {
+		t.Errorf("other session refresh: got status %d; want %d", status, http.StatusCreated)
+	}
+}
+
+func TestDeleteOtherSessions(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app)
+	insertTestUser(t, app, "alice@example.com")
+	first, _ := ts.login(t, "alice@example.com", testPassword)
+	second, _ := ts.login(t, "alice@example.com", testPassword)
+
+	status, _ := ts.do(t, http.MethodDelete, "/v1/tokens/sessions", first, nil)
+	if status != http.StatusOK {
+		t.Fatalf("delete other sessions: got status %d; want %d", status, http.StatusOK)
+	}
+	status, _ = ts.do(t, http.MethodGet, "/v1/users/me", first, nil)
+	if status != http.StatusOK {
+		t.Errorf("current session: got status %d; want %d", status, http.StatusOK)
+	}
+	status, _ = ts.do(t, http.MethodGet, "/v1/users/me", second, nil)
+	if status != http.StatusUnauthorized {
+		t.Errorf("other session: got status %d; want %d", status, http.StatusUnauthorized)
+	}
+}
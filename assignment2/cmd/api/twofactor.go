@@ -0,0 +1,222 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.assignment2.com/internal/data"
+	"golang.assignment2.com/internal/totp"
+	"golang.assignment2.com/internal/validator"
+)
+
+const totpIssuer = "Greenlight"
+
+func (app *application) verifySecondFactor(models data.Models, tf *data.TwoFactor, code string) (bool, error) {
+	if step, ok := totp.Validate(tf.Secret, code, time.Now(), 1); ok {
+		err := models.TwoFactor.UseStep(tf.UserID, step)
+		if err != nil {
+			if errors.Is(err, data.ErrRecordNotFound) {
+				return false, nil
+			}
+			return false, err
+		}
+		return true, nil
+	}
+	err := models.TwoFactor.UseRecoveryCode(tf.UserID, code)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	app.logger.PrintInfo("recovery code used", map[string]string{
+		"user_id": strconv.FormatInt(tf.UserID, 10),
+	})
+	return true, nil
+}
+
+func (app *application) showTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	tf, err := app.models.TwoFactor.Get(user.ID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			err = app.writeResponse(w, r, http.StatusOK, envelope{"enabled": false, "recovery_codes_remaining": 0}, nil)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	remaining, err := app.models.TwoFactor.CountRecoveryCodes(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"enabled": tf.Confirmed, "recovery_codes_remaining": remaining}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) enrollTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	tf := &data.TwoFactor{UserID: user.ID, Secret: secret}
+	err = app.models.TwoFactor.Upsert(tf)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			v := validator.New()
+			v.AddError("two_factor", "is already enabled")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	env := envelope{
+		"secret":      totp.EncodeSecret(secret),
+		"otpauth_uri": totp.URI(totpIssuer, user.Email, secret),
+	}
+	err = app.writeResponse(w, r, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+type confirmTwoFactorInput struct {
+	Code string `json:"code"`
+}
+
+func (app *application) confirmTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var input confirmTwoFactorInput
+	err := app.decodeRequest(w, r, &input)
+	if err != nil {
+		app.decodeErrorResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if v.Check(input.Code != "", "code", "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user := app.contextGetUser(r)
+	tf, err := app.models.TwoFactor.Get(user.ID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if tf == nil || tf.Confirmed {
+		v.AddError("code", "no pending two-factor enrollment")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	step, ok := totp.Validate(tf.Secret, input.Code, time.Now(), 1)
+	if !ok {
+		v.AddError("code", "is incorrect")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	tx, models, err := app.models.BeginTx(r.Context())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	defer tx.Rollback()
+	err = models.TwoFactor.Confirm(user.ID, step)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	codes, err := models.TwoFactor.ReplaceRecoveryCodes(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.logger.PrintInfo("two-factor authentication enabled", map[string]string{
+		"user_id": strconv.FormatInt(user.ID, 10),
+	})
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"recovery_codes": codes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+type disableTwoFactorInput struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+func (app *application) disableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var input disableTwoFactorInput
+	err := app.decodeRequest(w, r, &input)
+	if err != nil {
+		app.decodeErrorResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	v.Check(input.Password != "", "password", "must be provided")
+	v.Check(input.Code != "", "code", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user := app.contextGetUser(r)
+	match, err := user.Password.Matches(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !match {
+		v.AddError("password", "is incorrect")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	tf, err := app.models.TwoFactor.Get(user.ID)
+	if err != nil {
+		app.dataErrorResponse(w, r, err)
+		return
+	}
+	if tf.Confirmed {
+		ok, err := app.verifySecondFactor(app.models, tf, input.Code)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !ok {
+			v.AddError("code", "is incorrect")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+	err = app.models.TwoFactor.Delete(user.ID)
+	if err != nil {
+		app.dataErrorResponse(w, r, err)
+		return
+	}
+	app.logger.PrintInfo("two-factor authentication disabled", map[string]string{
+		"user_id": strconv.FormatInt(user.ID, 10),
+	})
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "two-factor authentication successfully disabled"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
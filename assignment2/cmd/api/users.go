@@ -3,21 +3,24 @@ package main
 import (
 	"errors"
 	"net/http"
+	"strings"
 	"time"
 
 	"golang.assignment2.com/internal/data"
 	"golang.assignment2.com/internal/validator"
 )
 
+type registerUserInput struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
 func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		Name     string `json:"name"`
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
-	err := app.readJSON(w, r, &input)
+	var input registerUserInput
+	err := app.decodeRequest(w, r, &input)
 	if err != nil {
-		app.badRequestResponse(w, r, err)
+		app.decodeErrorResponse(w, r, err)
 		return
 	}
 	user := &data.User{
@@ -37,13 +40,7 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	}
 	err = app.models.Users.Insert(user)
 	if err != nil {
-		switch {
-		case errors.Is(err, data.ErrDuplicateEmail):
-			v.AddError("email", "a user with this email address already exists")
-			app.failedValidationResponse(w, r, v.Errors)
-		default:
-			app.serverErrorResponse(w, r, err)
-		}
+		app.dataErrorResponse(w, r, err)
 		return
 	}
 	err = app.models.Permissions.AddForUser(user.ID, "plantseed:read")
@@ -66,19 +63,21 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 			app.logger.PrintError(err, nil)
 		}
 	})
-	err = app.writeJSON(w, http.StatusAccepted, envelope{"user": user}, nil)
+	err = app.writeResponse(w, r, http.StatusAccepted, envelope{"user": user}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
+type activateUserInput struct {
+	TokenPlaintext string `json:"token"`
+}
+
 func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		TokenPlaintext string `json:"token"`
-	}
-	err := app.readJSON(w, r, &input)
+	var input activateUserInput
+	err := app.decodeRequest(w, r, &input)
 	if err != nil {
-		app.badRequestResponse(w, r, err)
+		app.decodeErrorResponse(w, r, err)
 		return
 	}
 	v := validator.New()
@@ -97,23 +96,392 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		}
 		return
 	}
+	if user.Disabled() {
+		app.accountDisabledResponse(w, r)
+		return
+	}
 	user.Activated = true
 	err = app.models.Users.Update(user)
+	if err != nil {
+		app.dataErrorResponse(w, r, err)
+		return
+	}
+	err = app.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+type updateUserPasswordInput struct {
+	Password       string `json:"password"`
+	TokenPlaintext string `json:"token"`
+}
+
+func (app *application) updateUserPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var input updateUserPasswordInput
+	err := app.decodeRequest(w, r, &input)
+	if err != nil {
+		app.decodeErrorResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	data.ValidatePasswordPlaintext(v, input.Password)
+	data.ValidateTokenPlaintext(v, input.TokenPlaintext)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user, err := app.models.Users.GetForToken(data.ScopePasswordReset, input.TokenPlaintext)
 	if err != nil {
 		switch {
-		case errors.Is(err, data.ErrEditConflict):
-			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired password reset token")
+			app.failedValidationResponse(w, r, v.Errors)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
-	err = app.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
+	err = user.Password.Set(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.models.Users.Update(user)
+	if err != nil {
+		app.dataErrorResponse(w, r, err)
+		return
+	}
+	for _, scope := range []string{data.ScopePasswordReset, data.ScopeEmailChange, data.ScopeAuthentication, data.ScopeRefresh} {
+		err = app.models.Tokens.DeleteAllForUser(scope, user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	app.revokeUserSessions(user.ID)
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "your password was successfully reset"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) writeProfile(w http.ResponseWriter, r *http.Request, user *data.User) {
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if permissions == nil {
+		permissions = data.Permissions{}
+	}
+	env := envelope{"user": user, "permissions": permissions, "version": user.Version}
+	err = app.writeResponse(w, r, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.writeProfile(w, r, app.contextGetUser(r))
+}
+
+type updateCurrentUserInput struct {
+	Name    *string `json:"name"`
+	Version *int    `json:"version"`
+}
+
+func (app *application) updateCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	var input updateCurrentUserInput
+	err := app.decodeRequest(w, r, &input)
+	if err != nil {
+		app.decodeErrorResponse(w, r, err)
+		return
+	}
+	user := app.contextGetUser(r)
+	if input.Version != nil && *input.Version != user.Version {
+		app.editConflictResponse(w, r)
+		return
+	}
+	if input.Name != nil {
+		user.Name = *input.Name
+	}
+	v := validator.New()
+	if data.ValidateUser(v, user); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Users.Update(user)
+	if err != nil {
+		app.dataErrorResponse(w, r, err)
+		return
+	}
+	app.writeProfile(w, r, user)
+}
+
+type updateCurrentUserPasswordInput struct {
+	CurrentPassword string `json:"current_password"`
+	Password        string `json:"password"`
+}
+
+func (app *application) updateCurrentUserPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var input updateCurrentUserPasswordInput
+	err := app.decodeRequest(w, r, &input)
+	if err != nil {
+		app.decodeErrorResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	v.Check(input.CurrentPassword != "", "current_password", "must be provided")
+	if data.ValidatePasswordPlaintext(v, input.Password); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user := app.contextGetUser(r)
+	match, err := user.Password.Matches(input.CurrentPassword)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !match {
+		v.AddError("current_password", "is incorrect")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = user.Password.Set(input.Password)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
-	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	err = app.models.Users.Update(user)
+	if err != nil {
+		app.dataErrorResponse(w, r, err)
+		return
+	}
+	for _, scope := range []string{data.ScopePasswordReset, data.ScopeEmailChange} {
+		err = app.models.Tokens.DeleteAllForUser(scope, user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	families, err := app.models.Tokens.DeleteOtherSessions(user.ID, app.contextGetSession(r).family)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.revokeSessions(families...)
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "your password was successfully changed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+type deleteCurrentUserInput struct {
+	Password string `json:"password"`
+}
+
+func (app *application) deleteCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	var input deleteCurrentUserInput
+	err := app.decodeRequest(w, r, &input)
+	if err != nil {
+		app.decodeErrorResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if v.Check(input.Password != "", "password", "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user := app.contextGetUser(r)
+	match, err := user.Password.Matches(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !match {
+		v.AddError("password", "is incorrect")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Users.Delete(user.ID)
+	if err != nil {
+		app.dataErrorResponse(w, r, err)
+		return
+	}
+	app.revokeUserSessions(user.ID)
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "your account was successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+type createEmailChangeInput struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+func (app *application) createEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	var input createEmailChangeInput
+	err := app.decodeRequest(w, r, &input)
+	if err != nil {
+		app.decodeErrorResponse(w, r, err)
+		return
+	}
+	user := app.contextGetUser(r)
+	v := validator.New()
+	data.ValidateEmail(v, input.Email)
+	v.Check(!strings.EqualFold(input.Email, user.Email), "email", "must be different from the current email address")
+	v.Check(input.Password != "", "password", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	match, err := user.Password.Matches(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !match {
+		v.AddError("password", "is incorrect")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	_, err = app.models.Users.GetByEmail(input.Email)
+	switch {
+	case err == nil:
+		app.dataErrorResponse(w, r, data.ErrDuplicateEmail)
+		return
+	case !errors.Is(err, data.ErrRecordNotFound):
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	for _, scope := range []string{data.ScopeEmailChange, data.ScopeEmailChangeCancel} {
+		err = app.models.Tokens.DeleteAllForUser(scope, user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	token, err := app.models.Tokens.NewEmailChange(user.ID, 24*time.Hour, input.Email)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	cancelToken, err := app.models.Tokens.New(user.ID, 24*time.Hour, data.ScopeEmailChangeCancel)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.background(func() {
+		data := map[string]interface{}{
+			"name":             user.Name,
+			"email":            input.Email,
+			"emailChangeToken": token.Plaintext,
+			"cancelToken":      cancelToken.Plaintext,
+		}
+		err := app.mailer.Send(input.Email, "email_change.tmpl", data)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+		err = app.mailer.Send(user.Email, "email_change_notice.tmpl", data)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+	env := envelope{"message": "an email will be sent to the new address containing confirmation instructions"}
+	err = app.writeResponse(w, r, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+type confirmEmailChangeInput struct {
+	TokenPlaintext string `json:"token"`
+}
+
+func (app *application) confirmEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	var input confirmEmailChangeInput
+	err := app.decodeRequest(w, r, &input)
+	if err != nil {
+		app.decodeErrorResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user, email, err := app.models.Users.GetForEmailChange(input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired email change token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	user.Email = email
+	err = app.models.Users.Update(user)
+	if err != nil {
+		app.dataErrorResponse(w, r, err)
+		return
+	}
+	for _, scope := range []string{data.ScopeEmailChange, data.ScopeEmailChangeCancel, data.ScopePasswordReset} {
+		err = app.models.Tokens.DeleteAllForUser(scope, user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+type cancelEmailChangeInput struct {
+	TokenPlaintext string `json:"token"`
+}
+
+func (app *application) cancelEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	var input cancelEmailChangeInput
+	err := app.decodeRequest(w, r, &input)
+	if err != nil {
+		app.decodeErrorResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	user, err := app.models.Users.GetForToken(data.ScopeEmailChangeCancel, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired email change cancellation token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	for _, scope := range []string{data.ScopeEmailChange, data.ScopeEmailChangeCancel} {
+		err = app.models.Tokens.DeleteAllForUser(scope, user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "the pending email address change was cancelled"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"golang.assignment2.com/internal/data"
+)
+
+func TestResetPassword(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app)
+	user := insertTestUser(t, app, "alice@example.com")
+	access, _ := ts.login(t, "alice@example.com", testPassword)
+	reset, err := app.models.Tokens.New(user.ID, 45*time.Minute, data.ScopePasswordReset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	emailChange, err := app.models.Tokens.NewEmailChange(user.ID, 24*time.Hour, "alice@example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := envelope{"password": "n3w-pa55word", "token": reset.Plaintext}
+	status, _ := ts.do(t, http.MethodPut, "/v1/users/password", "", input)
+	if status != http.StatusOK {
+		t.Fatalf("reset: got status %d; want %d", status, http.StatusOK)
+	}
+	status, _ = ts.do(t, http.MethodPut, "/v1/users/password", "", input)
+	if status != http.StatusUnprocessableEntity {
+		t.Errorf("reused reset token: got status %d; want %d", status, http.StatusUnprocessableEntity)
+	}
+	status, _ = ts.do(t, http.MethodGet, "/v1/users/me", access, nil)
+	if status != http.StatusUnauthorized {
+		t.Errorf("session after reset: got status %d; want %d", status, http.StatusUnauthorized)
+	}
+	_, _, err = app.models.Users.GetForEmailChange(emailChange.Plaintext)
+	if !errors.Is(err, data.ErrRecordNotFound) {
+		t.Errorf("email change token after reset: got error %v; want %v", err, data.ErrRecordNotFound)
+	}
+	ts.login(t, "alice@example.com", "n3w-pa55word")
+}
+
+func TestChangeCurrentUserPassword(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app)
+	user := insertTestUser(t, app, "alice@example.com")
+	current, _ := ts.login(t, "alice@example.com", testPassword)
+	other, _ := ts.login(t, "alice@example.com", testPassword)
+	emailChange, err := app.models.Tokens.NewEmailChange(user.ID, 24*time.Hour, "alice@example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, _ := ts.do(t, http.MethodPut, "/v1/users/me/password", current, envelope{"current_password": "wrong-password", "password": "n3w-pa55word"})
+	if status != http.StatusUnprocessableEntity {
+		t.Errorf("wrong current password: got status %d; want %d", status, http.StatusUnprocessableEntity)
+	}
+	status, _ = ts.do(t, http.MethodPut, "/v1/users/me/password", current, envelope{"current_password": testPassword, "password": "n3w-pa55word"})
+	if status != http.StatusOK {
+		t.Fatalf("change password: got status %d; want %d", status, http.StatusOK)
+	}
+	status, _ = ts.do(t, http.MethodGet, "/v1/users/me", current, nil)
+	if status != http.StatusOK {
+		t.Errorf("current session: got status %d; want %d", status, http.StatusOK)
+	}
+	status, _ = ts.do(t, http.MethodGet, "/v1/users/me", other, nil)
+	if status != http.StatusUnauthorized {
+		t.Errorf("other session: got status %d; want %d", status, http.StatusUnauthorized)
+	}
+	_, _, err = app.models.Users.GetForEmailChange(emailChange.Plaintext)
+	if !errors.Is(err, data.ErrRecordNotFound) {
+		t.Errorf("email change token after password change: got error %v; want %v", err, data.ErrRecordNotFound)
+	}
+	ts.login(t, "alice@example.com", "n3w-pa55word")
+}
+
+func TestConfirmEmailChange(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app)
+	user := insertTestUser(t, app, "alice@example.com")
+	token, err := app.models.Tokens.NewEmailChange(user.ID, 24*time.Hour, "alice@example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, env := ts.do(t, http.MethodPut, "/v1/users/email", "", envelope{"token": token.Plaintext})
+	if status != http.StatusOK {
+		t.Fatalf("confirm: got status %d; want %d", status, http.StatusOK)
+	}
+	if got := env["user"].(map[string]interface{})["email"]; got != "alice@example.org" {
+		t.Errorf("got email %v; want %q", got, "alice@example.org")
+	}
+	status, _ = ts.do(t, http.MethodPut, "/v1/users/email", "", envelope{"token": token.Plaintext})
+	if status != http.StatusUnprocessableEntity {
+		t.Errorf("reused token: got status %d; want %d", status, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestCancelEmailChange(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app)
+	user := insertTestUser(t, app, "alice@example.com")
+	token, err := app.models.Tokens.NewEmailChange(user.ID, 24*time.Hour, "alice@example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel, err := app.models.Tokens.New(user.ID, 24*time.Hour, data.ScopeEmailChangeCancel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, _ := ts.do(t, http.MethodPut, "/v1/users/email/cancel", "", envelope{"token": cancel.Plaintext})
+	if status != http.StatusOK {
+		t.Fatalf("cancel: got status %d; want %d", status, http.StatusOK)
+	}
+	status, _ = ts.do(t, http.MethodPut, "/v1/users/email", "", envelope{"token": token.Plaintext})
+	if status != http.StatusUnprocessableEntity {
+		t.Errorf("confirm after cancel: got status %d; want %d", status, http.StatusUnprocessableEntity)
+	}
+	status, _ = ts.do(t, http.MethodPut, "/v1/users/email/cancel", "", envelope{"token": cancel.Plaintext})
+	if status != http.StatusUnprocessableEntity {
+		t.Errorf("reused cancel token: got status %d; want %d", status, http.StatusUnprocessableEntity)
+	}
+}
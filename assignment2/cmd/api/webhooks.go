@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"golang.assignment2.com/internal/data"
+	"golang.assignment2.com/internal/validator"
+)
+
+const (
+	webhookBatchSize  = 10
+	webhookLease      = 5 * time.Minute
+	maxWebhookBackoff = 6 * time.Hour
+)
+
+var errWebhookAddress = errors.New("webhook address is not allowed")
+
+var webhookClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: webhookDialControl,
+		}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+		MaxIdleConns:        10,
+		IdleConnTimeout:     90 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+func webhookDialControl(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !data.WebhookAddressAllowed(ip) {
+		return errWebhookAddress
+	}
+	return nil
+}
+
+type createWebhookInput struct {
+	URL        string   `json:"url"`
+	Secret     string   `json:"secret"`
+	EventTypes []string `json:"event_types"`
+}
+
+type updateWebhookInput struct {
+	URL        *string  `json:"url"`
+	Secret     *string  `json:"secret"`
+	EventTypes []string `json:"event_types"`
+	Active     *bool    `json:"active"`
+}
+
+func generateWebhookSecret() (string, error) {
+	randomBytes := make([]byte, 32)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(randomBytes), nil
+}
+
+func (app *application) createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var input createWebhookInput
+	err := app.decodeRequest(w, r, &input)
+	if err != nil {
+		app.decodeErrorResponse(w, r, err)
+		return
+	}
+	if input.Secret == "" {
+		input.Secret, err = generateWebhookSecret()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	webhook := &data.Webhook{
+		UserID:     app.contextGetUser(r).ID,
+		URL:        input.URL,
+		Secret:     input.Secret,
+		EventTypes: input.EventTypes,
+		Active:     true,
+	}
+	v := validator.New()
+	if data.ValidateWebhook(v, webhook, eventTypes); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Webhooks.Insert(webhook)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/webhooks/%d", webhook.ID))
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"webhook": webhook, "secret": webhook.Secret}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := app.models.Webhooks.GetAllForUser(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"webhooks": webhooks}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	webhook, err := app.models.Webhooks.Get(id, app.contextGetUser(r).ID)
+	if err != nil {
+		app.dataErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"webhook": webhook}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	webhook, err := app.models.Webhooks.Get(id, app.contextGetUser(r).ID)
+	if err != nil {
+		app.dataErrorResponse(w, r, err)
+		return
+	}
+	var input updateWebhookInput
+	err = app.decodeRequest(w, r, &input)
+	if err != nil {
+		app.decodeErrorResponse(w, r, err)
+		return
+	}
+	if input.URL != nil {
+		webhook.URL = *input.URL
+	}
+	if input.Secret != nil {
+		webhook.Secret = *input.Secret
+	}
+	if input.EventTypes != nil {
+		webhook.EventTypes = input.EventTypes
+	}
+	if input.Active != nil {
+		webhook.Active = *input.Active
+	}
+	v := validator.New()
+	if data.ValidateWebhook(v, webhook, eventTypes); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Webhooks.Update(webhook)
+	if err != nil {
+		app.dataErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"webhook": webhook}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = app.models.Webhooks.Delete(id, app.contextGetUser(r).ID)
+	if err != nil {
+		app.dataErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "webhook successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	webhook, err := app.models.Webhooks.Get(id, app.contextGetUser(r).ID)
+	if err != nil {
+		app.dataErrorResponse(w, r, err)
+		return
+	}
+	var input struct {
+		Status string
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Status = app.readString(qs, "status", "")
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readCSV(qs, "sort", []string{"-id"})
+	input.Filters.SortSafelist = []string{"id", "next_attempt_at", "-id", "-next_attempt_at"}
+	if input.Status != "" {
+		v.Check(validator.In(input.Status, data.DeliveryStatuses...), "status", "unsupported delivery status")
+	}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	deliveries, metadata, err := app.models.Webhooks.GetDeliveries(webhook.ID, input.Status, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	headers := app.paginationLinks(r, &metadata)
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"deliveries": deliveries, "metadata": metadata}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listWebhookDeliveryAttemptsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	deliveryID, err := app.readInt64Param(r, "delivery_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	webhook, err := app.models.Webhooks.Get(id, app.contextGetUser(r).ID)
+	if err != nil {
+		app.dataErrorResponse(w, r, err)
+		return
+	}
+	attempts, err := app.models.Webhooks.GetAttempts(deliveryID, webhook.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"attempts": attempts}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) redeliverWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	deliveryID, err := app.readInt64Param(r, "delivery_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	webhook, err := app.models.Webhooks.Get(id, app.contextGetUser(r).ID)
+	if err != nil {
+		app.dataErrorResponse(w, r, err)
+		return
+	}
+	delivery, err := app.models.Webhooks.Redeliver(deliveryID, webhook.ID)
+	if err != nil {
+		app.dataErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeResponse(w, r, http.StatusAccepted, envelope{"delivery": delivery}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func signWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+func sendWebhook(delivery *data.WebhookDelivery) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Greenlight-Webhooks/1.0")
+	req.Header.Set("X-Greenlight-Event", delivery.EventType)
+	req.Header.Set("X-Greenlight-Delivery", strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set("X-Greenlight-Signature", signWebhook(delivery.Secret, time.Now().Unix(), delivery.Payload))
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func (app *application) webhookBackoff(attempts int) time.Duration {
+	backoff := app.config.webhooks.backoff
+	for i := 1; i < attempts && backoff < maxWebhookBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxWebhookBackoff {
+		backoff = maxWebhookBackoff
+	}
+	return backoff
+}
+
+func (app *application) deliverWebhook(delivery *data.WebhookDelivery) {
+	delivery.Attempts++
+	status, err := sendWebhook(delivery)
+	delivery.LastResponseStatus = status
+	delivery.LastError = ""
+	switch {
+	case err == nil:
+		delivery.Status = data.DeliverySucceeded
+	case delivery.Attempts >= app.config.webhooks.maxAttempts:
+		delivery.Status = data.DeliveryDead
+		delivery.LastError = err.Error()
+	default:
+		delivery.LastError = err.Error()
+		delivery.NextAttemptAt = time.Now().Add(app.webhookBackoff(delivery.Attempts))
+	}
+	properties := map[string]string{
+		"delivery_id": strconv.FormatInt(delivery.ID, 10),
+		"webhook_id":  strconv.FormatInt(delivery.WebhookID, 10),
+	}
+	err = app.models.Webhooks.RecordAttempt(delivery)
+	if err != nil {
+		app.logger.PrintError(err, properties)
+		return
+	}
+	if delivery.Status == data.DeliveryDead {
+		properties["attempts"] = strconv.Itoa(delivery.Attempts)
+		properties["last_error"] = delivery.LastError
+		app.logger.PrintInfo("webhook delivery moved to dead letter", properties)
+	}
+}
+
+func (app *application) deliverWebhooks() {
+	deliveries, err := app.models.Webhooks.ClaimDue(webhookBatchSize, webhookLease)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+	for _, delivery := range deliveries {
+		app.deliverWebhook(delivery)
+	}
+	if len(deliveries) > 0 {
+		app.logger.PrintInfo("webhook deliveries processed", map[string]string{
+			"deliveries": strconv.Itoa(len(deliveries)),
+		})
+	}
+}
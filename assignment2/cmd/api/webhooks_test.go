@@ -0,0 +1,23 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebhookClientRejectsLoopback(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("webhook request reached a loopback server")
+	}))
+	defer ts.Close()
+	req, err := http.NewRequest(http.MethodPost, ts.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = webhookClient.Do(req)
+	if !errors.Is(err, errWebhookAddress) {
+		t.Fatalf("got error %v; want %v", err, errWebhookAddress)
+	}
+}
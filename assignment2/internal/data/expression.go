@@ -0,0 +1,354 @@
+package data
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	maxFilterLength = 1000
+	maxFilterDepth  = 20
+)
+
+type FilterFieldType int
+
+const (
+	FilterText FilterFieldType = iota
+	FilterNumber
+)
+
+type FilterField struct {
+	Column string
+	Type   FilterFieldType
+	Config string
+}
+
+type FilterSchema map[string]FilterField
+
+type FilterError struct {
+	Position int
+	Token    string
+	Message  string
+}
+
+func (e *FilterError) Error() string {
+	if e.Token == "" {
+		return fmt.Sprintf("%s at position %d", e.Message, e.Position)
+	}
+	return fmt.Sprintf("%s at position %d near %q", e.Message, e.Position, e.Token)
+}
+
+type filterTokenKind int
+
+const (
+	tokenEOF filterTokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenOperator
+	tokenLParen
+	tokenRParen
+	tokenAnd
+	tokenOr
+	tokenNot
+)
+
+type filterToken struct {
+	kind     filterTokenKind
+	text     string
+	value    string
+	position int
+}
+
+func lexFilter(input string) ([]filterToken, error) {
+	var tokens []filterToken
+	runes := []rune(input)
+	i := 0
+	for i < len(runes) {
+		r := runes[i]
+		start := i
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+		case r == '(':
+			tokens = append(tokens, filterToken{kind: tokenLParen, text: "(", position: start + 1})
+			i++
+		case r == ')':
+			tokens = append(tokens, filterToken{kind: tokenRParen, text: ")", position: start + 1})
+			i++
+		case r == ':' || r == '=':
+			tokens = append(tokens, filterToken{kind: tokenOperator, text: string(r), position: start + 1})
+			i++
+		case r == '!' || r == '<' || r == '>':
+			op := string(r)
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				op += "="
+			}
+			if op == "!" {
+				return nil, &FilterError{Position: start + 1, Token: op, Message: "unexpected character"}
+			}
+			tokens = append(tokens, filterToken{kind: tokenOperator, text: op, position: start + 1})
+			i += len(op)
+		case r == '"':
+			var sb strings.Builder
+			i++
+			closed := false
+			for i < len(runes) {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					sb.WriteRune(runes[i+1])
+					i += 2
+					continue
+				}
+				if runes[i] == '"' {
+					closed = true
+					i++
+					break
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			if !closed {
+				return nil, &FilterError{Position: start + 1, Token: string(runes[start:]), Message: "unterminated string"}
+			}
+			tokens = append(tokens, filterToken{kind: tokenString, text: string(runes[start:i]), value: sb.String(), position: start + 1})
+		case r == '-' || unicode.IsDigit(r):
+			i++
+			for i < len(runes) && unicode.IsDigit(runes[i]) {
+				i++
+			}
+			text := string(runes[start:i])
+			if text == "-" {
+				return nil, &FilterError{Position: start + 1, Token: text, Message: "unexpected character"}
+			}
+			tokens = append(tokens, filterToken{kind: tokenNumber, text: text, value: text, position: start + 1})
+		case unicode.IsLetter(r) || r == '_':
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || strings.ContainsRune("_-.", runes[i])) {
+				i++
+			}
+			text := string(runes[start:i])
+			token := filterToken{kind: tokenIdent, text: text, value: text, position: start + 1}
+			switch strings.ToUpper(text) {
+			case "AND":
+				token.kind = tokenAnd
+			case "OR":
+				token.kind = tokenOr
+			case "NOT":
+				token.kind = tokenNot
+			}
+			tokens = append(tokens, token)
+		default:
+			return nil, &FilterError{Position: start + 1, Token: string(r), Message: "unexpected character"}
+		}
+	}
+	tokens = append(tokens, filterToken{kind: tokenEOF, position: len(runes) + 1})
+	return tokens, nil
+}
+
+type filterCompiler struct {
+	args   []interface{}
+	argPos int
+	config string
+}
+
+func (c *filterCompiler) bind(value interface{}) string {
+	c.args = append(c.args, value)
+	return fmt.Sprintf("$%d", c.argPos+len(c.args)-1)
+}
+
+type filterNode interface {
+	sql(c *filterCompiler) string
+}
+
+type filterBinary struct {
+	operator    string
+	left, right filterNode
+}
+
+func (n filterBinary) sql(c *filterCompiler) string {
+	left := n.left.sql(c)
+	right := n.right.sql(c)
+	return fmt.Sprintf("(%s %s %s)", left, n.operator, right)
+}
+
+type filterNot struct {
+	operand filterNode
+}
+
+func (n filterNot) sql(c *filterCompiler) string {
+	return fmt.Sprintf("(NOT %s)", n.operand.sql(c))
+}
+
+type filterComparison struct {
+	field    FilterField
+	operator string
+	value    interface{}
+}
+
+func (n filterComparison) sql(c *filterCompiler) string {
+	switch {
+	case n.operator == ":" && n.field.Type == FilterText:
+		config := n.field.Config
+		if config != "" && c.config != "" {
+			config = c.config
+		}
+		if config == "" {
+			config = "'simple'"
+		}
+		return fmt.Sprintf("to_tsvector(%s, %s) @@ plainto_tsquery(%s, %s)", config, n.field.Column, config, c.bind(n.value))
+	case n.operator == ":" || n.operator == "=":
+		return fmt.Sprintf("%s = %s", n.field.Column, c.bind(n.value))
+	case n.operator == "!=":
+		return fmt.Sprintf("%s <> %s", n.field.Column, c.bind(n.value))
+	default:
+		return fmt.Sprintf("%s %s %s", n.field.Column, n.operator, c.bind(n.value))
+	}
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+	depth  int
+	schema FilterSchema
+}
+
+func parseFilter(input string, schema FilterSchema) (filterNode, error) {
+	if len(input) > maxFilterLength {
+		return nil, &FilterError{Position: maxFilterLength + 1, Message: fmt.Sprintf("filter must not be more than %d bytes long", maxFilterLength)}
+	}
+	tokens, err := lexFilter(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens, schema: schema}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, p.errorAt(tok, "unexpected token")
+	}
+	return node, nil
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() filterToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *filterParser) errorAt(tok filterToken, message string) error {
+	if tok.kind == tokenEOF {
+		return &FilterError{Position: tok.position, Message: message + ": unexpected end of filter"}
+	}
+	return &FilterError{Position: tok.position, Token: tok.text, Message: message}
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = filterBinary{operator: "OR", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenAnd {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = filterBinary{operator: "AND", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	if p.peek().kind == tokenNot {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return filterNot{operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *filterParser) parsePrimary() (filterNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokenLParen:
+		p.depth++
+		if p.depth > maxFilterDepth {
+			return nil, p.errorAt(tok, "filter is nested too deeply")
+		}
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return nil, p.errorAt(closing, "expected closing parenthesis")
+		}
+		p.depth--
+		return node, nil
+	case tokenIdent:
+		return p.parseComparison(tok)
+	default:
+		return nil, p.errorAt(tok, "expected a field name or opening parenthesis")
+	}
+}
+
+func (p *filterParser) parseComparison(fieldTok filterToken) (filterNode, error) {
+	field, ok := p.schema[fieldTok.value]
+	if !ok {
+		return nil, p.errorAt(fieldTok, "unknown field")
+	}
+	opTok := p.next()
+	if opTok.kind != tokenOperator {
+		return nil, p.errorAt(opTok, "expected a comparison operator")
+	}
+	if field.Type == FilterText && !(opTok.text == ":" || opTok.text == "=" || opTok.text == "!=") {
+		return nil, p.errorAt(opTok, fmt.Sprintf("operator not supported for text field %q", fieldTok.value))
+	}
+	valueTok := p.next()
+	if valueTok.kind != tokenIdent && valueTok.kind != tokenNumber && valueTok.kind != tokenString {
+		return nil, p.errorAt(valueTok, "expected a value")
+	}
+	node := filterComparison{field: field, operator: opTok.text}
+	switch field.Type {
+	case FilterNumber:
+		if valueTok.kind != tokenNumber {
+			return nil, p.errorAt(valueTok, fmt.Sprintf("expected a number for field %q", fieldTok.value))
+		}
+		n, err := strconv.ParseInt(valueTok.value, 10, 64)
+		if err != nil {
+			return nil, p.errorAt(valueTok, "number out of range")
+		}
+		node.value = n
+	default:
+		node.value = valueTok.value
+	}
+	return node, nil
+}
@@ -0,0 +1,100 @@
+package data
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFilterCondition(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   string
+		args   []interface{}
+	}{
+		{
+			filter: "price<100",
+			want:   "price < $2",
+			args:   []interface{}{int64(100)},
+		},
+		{
+			filter: "name:rose",
+			want:   "to_tsvector(language, name) @@ plainto_tsquery(language, $2)",
+			args:   []interface{}{"rose"},
+		},
+		{
+			filter: `family="Rosa canina" AND amount>=-5`,
+			want:   "(family = $2 AND amount >= $3)",
+			args:   []interface{}{"Rosa canina", int64(-5)},
+		},
+		{
+			filter: "name!=tulip OR price>10 AND price<=20",
+			want:   "(name <> $2 OR (price > $3 AND price <= $4))",
+			args:   []interface{}{"tulip", int64(10), int64(20)},
+		},
+		{
+			filter: "(id=1 or id=2) and not name:rose",
+			want:   "((id = $2 OR id = $3) AND (NOT to_tsvector(language, name) @@ plainto_tsquery(language, $4)))",
+			args:   []interface{}{int64(1), int64(2), "rose"},
+		},
+		{
+			filter: `name:"say \"hi\""`,
+			want:   "to_tsvector(language, name) @@ plainto_tsquery(language, $2)",
+			args:   []interface{}{`say "hi"`},
+		},
+	}
+	for _, tt := range tests {
+		f := Filters{Filter: tt.filter, FilterSchema: PlantseedFilterSchema}
+		condition, args := f.filterCondition(2, "language")
+		if condition != tt.want {
+			t.Errorf("%s: got %q; want %q", tt.filter, condition, tt.want)
+		}
+		if !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("%s: got args %#v; want %#v", tt.filter, args, tt.args)
+		}
+	}
+}
+
+func TestFilterConditionLanguage(t *testing.T) {
+	f := Filters{Filter: "name:rose AND family=Rosa", FilterSchema: PlantseedFilterSchema}
+	condition, _ := f.filterCondition(4, "$3::regconfig")
+	want := "(to_tsvector($3::regconfig, name) @@ plainto_tsquery($3::regconfig, $4) AND family = $5)"
+	if condition != want {
+		t.Errorf("got %q; want %q", condition, want)
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	tests := []struct {
+		filter   string
+		position int
+		message  string
+	}{
+		{"colour:red", 1, "unknown field"},
+		{"name<rose", 5, "operator not supported"},
+		{"price:cheap", 7, "expected a number"},
+		{"price", 6, "expected a comparison operator"},
+		{"price<", 7, "expected a value"},
+		{"(price<1", 9, "expected closing parenthesis"},
+		{"price<1)", 8, "unexpected token"},
+		{`name:"rose`, 6, "unterminated string"},
+		{"name:rose & price<1", 11, "unexpected character"},
+		{"price!1", 6, "unexpected character"},
+		{"price<99999999999999999999", 7, "number out of range"},
+		{"AND price<1", 1, "expected a field name"},
+		{strings.Repeat("(", maxFilterDepth+1) + "id=1" + strings.Repeat(")", maxFilterDepth+1), maxFilterDepth + 1, "nested too deeply"},
+		{strings.Repeat("a", maxFilterLength+1), maxFilterLength + 1, "must not be more than"},
+	}
+	for _, tt := range tests {
+		_, err := parseFilter(tt.filter, PlantseedFilterSchema)
+		var filterErr *FilterError
+		if !errors.As(err, &filterErr) {
+			t.Errorf("%.30s: got error %v; want a FilterError", tt.filter, err)
+			continue
+		}
+		if filterErr.Position != tt.position || !strings.Contains(filterErr.Message, tt.message) {
+			t.Errorf("%.30s: got %q at %d; want %q at %d", tt.filter, filterErr.Message, filterErr.Position, tt.message, tt.position)
+		}
+	}
+}
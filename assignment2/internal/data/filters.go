@@ -1,56 +1,182 @@
 package data
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"math"
 	"strings"
 
 	"golang.assignment2.com/internal/validator"
 )
 
+var ErrInvalidCursor = errors.New("invalid cursor")
+
 type Filters struct {
 	Page         int
 	PageSize     int
-	Sort         string
+	Sort         []string
 	SortSafelist []string
+	Cursor       string
+	Filter       string
+	FilterSchema FilterSchema
+	Language     string
+}
+
+type sortKey struct {
+	column string
+	desc   bool
 }
 
-func (f Filters) sortColumn() string {
-	for _, safeValue := range f.SortSafelist {
-		if f.Sort == safeValue {
-			return strings.TrimPrefix(f.Sort, "-")
+func (f Filters) sortKeys() []sortKey {
+	keys := make([]sortKey, 0, len(f.Sort)+1)
+	hasID := false
+	for _, value := range f.Sort {
+		if !validator.In(value, f.SortSafelist...) {
+			panic("unsafe sort parameter: " + value)
 		}
+		key := sortKey{column: strings.TrimPrefix(value, "-"), desc: strings.HasPrefix(value, "-")}
+		if key.column == "id" {
+			hasID = true
+		}
+		keys = append(keys, key)
+	}
+	if !hasID {
+		keys = append(keys, sortKey{column: "id"})
 	}
-	panic("unsafe sort parameter: " + f.Sort)
+	return keys
 }
 
-func (f Filters) sortDirection() string {
-	if strings.HasPrefix(f.Sort, "-") {
-		return "DESC"
+func (f Filters) orderBy() string {
+	keys := f.sortKeys()
+	clauses := make([]string, len(keys))
+	for i, key := range keys {
+		direction := "ASC"
+		if key.desc {
+			direction = "DESC"
+		}
+		clauses[i] = fmt.Sprintf("%s %s", key.column, direction)
 	}
-	return "ASC"
+	return strings.Join(clauses, ", ")
+}
+
+func (f Filters) cursorCondition(argPos int) (string, []interface{}) {
+	values, err := decodeCursor(f.Cursor, f.Sort)
+	if err != nil {
+		panic("unsafe cursor parameter: " + f.Cursor)
+	}
+	keys := f.sortKeys()
+	var disjuncts []string
+	for i, key := range keys {
+		var conjuncts []string
+		for j := 0; j < i; j++ {
+			conjuncts = append(conjuncts, fmt.Sprintf("%s = $%d", keys[j].column, argPos+j))
+		}
+		operator := ">"
+		if key.desc {
+			operator = "<"
+		}
+		conjuncts = append(conjuncts, fmt.Sprintf("%s %s $%d", key.column, operator, argPos+i))
+		disjuncts = append(disjuncts, "("+strings.Join(conjuncts, " AND ")+")")
+	}
+	return "(" + strings.Join(disjuncts, " OR ") + ")", values
+}
+
+func (f Filters) filterCondition(argPos int, config string) (string, []interface{}) {
+	node, err := parseFilter(f.Filter, f.FilterSchema)
+	if err != nil {
+		panic("unsafe filter parameter: " + f.Filter)
+	}
+	c := &filterCompiler{argPos: argPos, config: config}
+	condition := node.sql(c)
+	return condition, c.args
 }
 
 func (f Filters) limit() int {
 	return f.PageSize
 }
+
 func (f Filters) offset() int {
+	if f.Cursor != "" {
+		return 0
+	}
 	return (f.Page - 1) * f.PageSize
 }
 
+type cursorPayload struct {
+	Sort   string        `json:"s"`
+	Values []interface{} `json:"v"`
+}
+
+func encodeCursor(sort []string, values []interface{}) string {
+	js, err := json.Marshal(cursorPayload{Sort: strings.Join(sort, ","), Values: values})
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+func decodeCursor(cursor string, sort []string) ([]interface{}, error) {
+	js, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	dec := json.NewDecoder(strings.NewReader(string(js)))
+	dec.UseNumber()
+	var payload cursorPayload
+	if err := dec.Decode(&payload); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if payload.Sort != strings.Join(sort, ",") {
+		return nil, ErrInvalidCursor
+	}
+	return payload.Values, nil
+}
+
 func ValidateFilters(v *validator.Validator, f Filters) {
 	v.Check(f.Page > 0, "page", "must be greater than zero")
 	v.Check(f.Page <= 10_000_000, "page", "must be a maximum of 10 million")
 	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
 	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
-	v.Check(validator.In(f.Sort, f.SortSafelist...), "sort", "invalid sort value")
+	v.Check(len(f.Sort) > 0, "sort", "must be provided")
+	columns := make([]string, len(f.Sort))
+	for i, value := range f.Sort {
+		v.Check(validator.In(value, f.SortSafelist...), "sort", fmt.Sprintf("invalid sort value %q", value))
+		columns[i] = strings.TrimPrefix(value, "-")
+	}
+	v.Check(validator.Unique(columns), "sort", "must not contain the same column more than once")
+	if f.Language != "" {
+		v.Check(validator.In(f.Language, SearchLanguages...), "lang", "unsupported search language")
+	}
+	if f.Filter != "" {
+		if _, err := parseFilter(f.Filter, f.FilterSchema); err != nil {
+			v.AddError("filter", err.Error())
+		}
+	}
+	if f.Cursor != "" && v.Valid() {
+		keys := f.sortKeys()
+		values, err := decodeCursor(f.Cursor, f.Sort)
+		v.Check(err == nil && len(values) == len(keys), "cursor", "invalid cursor for the requested sort")
+	}
 }
 
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+	CurrentPage  int        `json:"current_page,omitempty"`
+	PageSize     int        `json:"page_size,omitempty"`
+	FirstPage    int        `json:"first_page,omitempty"`
+	LastPage     int        `json:"last_page,omitempty"`
+	TotalRecords int        `json:"total_records,omitempty"`
+	NextCursor   string     `json:"next_cursor,omitempty"`
+	Links        *PageLinks `json:"links,omitempty"`
+}
+
+type PageLinks struct {
+	Self  string `json:"self"`
+	First string `json:"first,omitempty"`
+	Prev  string `json:"prev,omitempty"`
+	Next  string `json:"next,omitempty"`
+	Last  string `json:"last,omitempty"`
 }
 
 func calculateMetadata(totalRecords, page, pageSize int) Metadata {
@@ -65,3 +191,9 @@ func calculateMetadata(totalRecords, page, pageSize int) Metadata {
 		TotalRecords: totalRecords,
 	}
 }
+
+func calculateCursorMetadata(pageSize int) Metadata {
+	return Metadata{
+		PageSize: pageSize,
+	}
+}
@@ -0,0 +1,95 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var testSortSafelist = []string{"id", "name", "price", "-id", "-name", "-price"}
+
+func TestOrderBy(t *testing.T) {
+	tests := []struct {
+		sort []string
+		want string
+	}{
+		{[]string{"id"}, "id ASC"},
+		{[]string{"-id"}, "id DESC"},
+		{[]string{"name"}, "name ASC, id ASC"},
+		{[]string{"-price", "name"}, "price DESC, name ASC, id ASC"},
+		{[]string{"name", "-id"}, "name ASC, id DESC"},
+	}
+	for _, tt := range tests {
+		f := Filters{Sort: tt.sort, SortSafelist: testSortSafelist}
+		if got := f.orderBy(); got != tt.want {
+			t.Errorf("orderBy(%v): got %q; want %q", tt.sort, got, tt.want)
+		}
+	}
+}
+
+func TestOrderByPanicsOnUnsafeSort(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for an unsafe sort parameter")
+		}
+	}()
+	Filters{Sort: []string{"name; DROP TABLE users"}, SortSafelist: testSortSafelist}.orderBy()
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	sort := []string{"-price", "name"}
+	cursor := encodeCursor(sort, []interface{}{100, "rose", int64(7)})
+	values, err := decodeCursor(cursor, sort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{json.Number("100"), "rose", json.Number("7")}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("got %#v; want %#v", values, want)
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	sort := []string{"name"}
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"not base64", "%%%"},
+		{"not json", "bm90IGpzb24"},
+		{"different sort", encodeCursor([]string{"-name"}, []interface{}{"rose", 1})},
+	}
+	for _, tt := range tests {
+		_, err := decodeCursor(tt.cursor, sort)
+		if !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%s: got error %v; want %v", tt.name, err, ErrInvalidCursor)
+		}
+	}
+}
+
+func TestCursorCondition(t *testing.T) {
+	sort := []string{"-price", "name"}
+	f := Filters{
+		Sort:         sort,
+		SortSafelist: testSortSafelist,
+		Cursor:       encodeCursor(sort, []interface{}{100, "rose", 7}),
+	}
+	condition, args := f.cursorCondition(3)
+	want := "((price < $3) OR (price = $3 AND name > $4) OR (price = $3 AND name = $4 AND id > $5))"
+	if condition != want {
+		t.Errorf("got %q; want %q", condition, want)
+	}
+	if len(args) != 3 {
+		t.Errorf("got %d args; want 3", len(args))
+	}
+}
+
+func TestOffset(t *testing.T) {
+	if got := (Filters{Page: 3, PageSize: 20}).offset(); got != 40 {
+		t.Errorf("got offset %d; want 40", got)
+	}
+	if got := (Filters{Page: 3, PageSize: 20, Cursor: "abc"}).offset(); got != 0 {
+		t.Errorf("got offset %d with a cursor; want 0", got)
+	}
+}
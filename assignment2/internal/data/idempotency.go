@@ -0,0 +1,138 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"golang.assignment2.com/internal/validator"
+)
+
+type IdempotencyRecord struct {
+	UserID      int64
+	Key         string
+	Fingerprint []byte
+	Expiry      time.Time
+	Status      int
+	Headers     map[string][]string
+	Body        []byte
+}
+
+func (rec *IdempotencyRecord) Completed() bool {
+	return rec.Status != 0
+}
+
+func ValidateIdempotencyKey(v *validator.Validator, key string) {
+	v.Check(len(key) <= 255, "Idempotency-Key", "must not be more than 255 bytes long")
+	for _, c := range key {
+		if c < 0x21 || c > 0x7e {
+			v.AddError("Idempotency-Key", "must only contain printable ASCII characters")
+			break
+		}
+	}
+}
+
+type IdempotencyModel struct {
+	DB DBTX
+}
+
+func (m IdempotencyModel) Reserve(rec *IdempotencyRecord) (bool, error) {
+	query := `
+	INSERT INTO idempotency_keys (user_id, key, fingerprint, expiry)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (user_id, key) DO UPDATE
+	SET fingerprint = EXCLUDED.fingerprint, created_at = NOW(), expiry = EXCLUDED.expiry,
+		status = NULL, headers = NULL, body = NULL
+	WHERE idempotency_keys.expiry <= NOW()
+	RETURNING user_id`
+	args := []interface{}{rec.UserID, rec.Key, rec.Fingerprint, rec.Expiry}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var userID int64
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (m IdempotencyModel) Get(userID int64, key string) (*IdempotencyRecord, error) {
+	query := `
+	SELECT user_id, key, fingerprint, expiry, COALESCE(status, 0), headers, body
+	FROM idempotency_keys
+	WHERE user_id = $1 AND key = $2 AND expiry > NOW()`
+	var rec IdempotencyRecord
+	var headers []byte
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, userID, key).Scan(
+		&rec.UserID,
+		&rec.Key,
+		&rec.Fingerprint,
+		&rec.Expiry,
+		&rec.Status,
+		&headers,
+		&rec.Body,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	if headers != nil {
+		err = json.Unmarshal(headers, &rec.Headers)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &rec, nil
+}
+
+func (m IdempotencyModel) Complete(rec *IdempotencyRecord) error {
+	headers, err := json.Marshal(rec.Headers)
+	if err != nil {
+		return err
+	}
+	query := `
+	UPDATE idempotency_keys
+	SET status = $1, headers = $2, body = $3
+	WHERE user_id = $4 AND key = $5`
+	args := []interface{}{rec.Status, headers, rec.Body, rec.UserID, rec.Key}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err = m.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (m IdempotencyModel) Delete(userID int64, key string) error {
+	query := `
+	DELETE FROM idempotency_keys
+	WHERE user_id = $1 AND key = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, userID, key)
+	return err
+}
+
+func (m IdempotencyModel) DeleteExpired() (int64, error) {
+	query := `
+	DELETE FROM idempotency_keys
+	WHERE expiry <= NOW()`
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,196 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	LoginAttemptEmail = "email"
+	LoginAttemptIP    = "ip"
+)
+
+type LoginAttempt struct {
+	Kind          string
+	Key           string
+	Failures      int
+	Lockouts      int
+	LastFailureAt time.Time
+	LockedUntil   *time.Time
+}
+
+func (a *LoginAttempt) Locked() bool {
+	return a.LockedUntil != nil && a.LockedUntil.After(time.Now())
+}
+
+type LoginAttemptModel struct {
+	DB DBTX
+}
+
+func (m LoginAttemptModel) Get(kind, key string) (*LoginAttempt, error) {
+	query := `
+	SELECT kind, key, failures, lockouts, last_failure_at, locked_until
+	FROM login_attempts
+	WHERE kind = $1 AND key = $2`
+	var attempt LoginAttempt
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, kind, key).Scan(
+		&attempt.Kind,
+		&attempt.Key,
+		&attempt.Failures,
+		&attempt.Lockouts,
+		&attempt.LastFailureAt,
+		&attempt.LockedUntil,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &attempt, nil
+}
+
+func (m LoginAttemptModel) Acquire(kind, key string) (*LoginAttempt, error) {
+	insert := `
+	INSERT INTO login_attempts (kind, key)
+	VALUES ($1, $2)
+	ON CONFLICT (kind, key) DO NOTHING`
+	query := `
+	SELECT kind, key, failures, lockouts, last_failure_at, locked_until
+	FROM login_attempts
+	WHERE kind = $1 AND key = $2
+	FOR UPDATE`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, insert, kind, key)
+	if err != nil {
+		return nil, err
+	}
+	var attempt LoginAttempt
+	err = m.DB.QueryRowContext(ctx, query, kind, key).Scan(
+		&attempt.Kind,
+		&attempt.Key,
+		&attempt.Failures,
+		&attempt.Lockouts,
+		&attempt.LastFailureAt,
+		&attempt.LockedUntil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+func (m LoginAttemptModel) Reserve(attempt *LoginAttempt, window time.Duration) error {
+	query := `
+	UPDATE login_attempts
+	SET failures = CASE
+			WHEN last_failure_at < NOW() - make_interval(secs => $3) THEN 1
+			ELSE failures + 1
+		END,
+		last_failure_at = NOW()
+	WHERE kind = $1 AND key = $2
+	RETURNING failures, lockouts, last_failure_at, locked_until`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, attempt.Kind, attempt.Key, window.Seconds()).Scan(
+		&attempt.Failures,
+		&attempt.Lockouts,
+		&attempt.LastFailureAt,
+		&attempt.LockedUntil,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m LoginAttemptModel) Release(kind, key string) error {
+	query := `
+	UPDATE login_attempts
+	SET failures = GREATEST(failures - 1, 0)
+	WHERE kind = $1 AND key = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, kind, key)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (m LoginAttemptModel) Lock(attempt *LoginAttempt, duration time.Duration, threshold int) error {
+	query := `
+	UPDATE login_attempts
+	SET failures = 0, lockouts = lockouts + 1, locked_until = NOW() + make_interval(secs => $3)
+	WHERE kind = $1 AND key = $2 AND failures >= $4
+	RETURNING failures, lockouts, locked_until`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, attempt.Kind, attempt.Key, duration.Seconds(), threshold).Scan(
+		&attempt.Failures,
+		&attempt.Lockouts,
+		&attempt.LockedUntil,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m LoginAttemptModel) Clear(kind, key string) error {
+	query := `
+	DELETE FROM login_attempts
+	WHERE kind = $1 AND key = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, kind, key)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (m LoginAttemptModel) DeleteExpired(retention time.Duration) (int64, error) {
+	query := `
+	DELETE FROM login_attempts
+	WHERE last_failure_at < NOW() - make_interval(secs => $1)
+	AND (locked_until IS NULL OR locked_until < NOW() - make_interval(secs => $1))`
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, retention.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,99 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.assignment2.com/internal/testdb"
+)
+
+func reserveLoginAttempt(t *testing.T, m LoginAttemptModel, kind, key string) *LoginAttempt {
+	t.Helper()
+	attempt, err := m.Acquire(kind, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.Reserve(attempt, 15*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return attempt
+}
+
+func TestLoginAttemptLock(t *testing.T) {
+	m := LoginAttemptModel{DB: testdb.Open(t)}
+	reserveLoginAttempt(t, m, LoginAttemptIP, "192.0.2.1")
+	attempt := reserveLoginAttempt(t, m, LoginAttemptIP, "192.0.2.1")
+	if attempt.Failures != 2 {
+		t.Fatalf("got %d failures; want 2", attempt.Failures)
+	}
+	err := m.Release(LoginAttemptIP, "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	attempt = reserveLoginAttempt(t, m, LoginAttemptIP, "192.0.2.1")
+	if attempt.Failures != 2 {
+		t.Fatalf("got %d failures after a release; want 2", attempt.Failures)
+	}
+	stale := *attempt
+	err = m.Lock(attempt, 15*time.Minute, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !attempt.Locked() || attempt.Lockouts != 1 || attempt.Failures != 0 {
+		t.Errorf("got failures %d lockouts %d locked %t; want 0, 1, true", attempt.Failures, attempt.Lockouts, attempt.Locked())
+	}
+	err = m.Lock(&stale, 15*time.Minute, 2)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("second lock: got error %v; want %v", err, ErrRecordNotFound)
+	}
+}
+
+func TestLoginAttemptLockoutSurvivesPrune(t *testing.T) {
+	db := testdb.Open(t)
+	m := LoginAttemptModel{DB: db}
+	retention := 48 * time.Hour
+
+	attempt := reserveLoginAttempt(t, m, LoginAttemptEmail, "alice@example.com")
+	err := m.Lock(attempt, 15*time.Minute, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`
+	UPDATE login_attempts
+	SET last_failure_at = NOW() - interval '2 hours', locked_until = NOW() - interval '1 hour'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := m.DeleteExpired(retention)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 0 {
+		t.Fatalf("deleted %d attempts within the retention period; want 0", deleted)
+	}
+
+	attempt = reserveLoginAttempt(t, m, LoginAttemptEmail, "alice@example.com")
+	err = m.Lock(attempt, 30*time.Minute, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempt.Lockouts != 2 {
+		t.Errorf("got %d lockouts; want 2", attempt.Lockouts)
+	}
+
+	_, err = db.Exec(`
+	UPDATE login_attempts
+	SET last_failure_at = NOW() - interval '72 hours', locked_until = NOW() - interval '71 hours'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted, err = m.DeleteExpired(retention)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 1 {
+		t.Errorf("deleted %d attempts after the retention period; want 1", deleted)
+	}
+}
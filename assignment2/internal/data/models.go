@@ -1,6 +1,7 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 )
@@ -10,18 +11,49 @@ var (
 	ErrEditConflict   = errors.New("edit conflict")
 )
 
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
 type Models struct {
-	Plantseed   PlantseedModel
-	Permissions PermissionModel
-	Tokens      TokenModel
-	Users       UserModel
+	db            *sql.DB
+	Idempotency   IdempotencyModel
+	LoginAttempts LoginAttemptModel
+	Plantseed     PlantseedModel
+	Permissions   PermissionModel
+	SavedSearches SavedSearchModel
+	Tokens        TokenModel
+	TwoFactor     TwoFactorModel
+	Users         UserModel
+	Webhooks      WebhookModel
 }
 
 func NewModels(db *sql.DB) Models {
+	models := newModels(db)
+	models.db = db
+	return models
+}
+
+func newModels(db DBTX) Models {
 	return Models{
-		Plantseed:   PlantseedModel{DB: db},
-		Permissions: PermissionModel{DB: db},
-		Tokens:      TokenModel{DB: db},
-		Users:       UserModel{DB: db},
+		Idempotency:   IdempotencyModel{DB: db},
+		LoginAttempts: LoginAttemptModel{DB: db},
+		Plantseed:     PlantseedModel{DB: db},
+		Permissions:   PermissionModel{DB: db},
+		SavedSearches: SavedSearchModel{DB: db},
+		Tokens:        TokenModel{DB: db},
+		TwoFactor:     TwoFactorModel{DB: db},
+		Users:         UserModel{DB: db},
+		Webhooks:      WebhookModel{DB: db},
+	}
+}
+
+func (m Models) BeginTx(ctx context.Context) (*sql.Tx, Models, error) {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, Models{}, err
 	}
+	return tx, newModels(tx), nil
 }
@@ -2,7 +2,6 @@ package data
 
 import (
 	"context"
-	"database/sql"
 	"time"
 
 	"github.com/lib/pq"
@@ -20,7 +19,34 @@ func (p Permissions) Include(code string) bool {
 }
 
 type PermissionModel struct {
-	DB *sql.DB
+	DB DBTX
+}
+
+func (m PermissionModel) GetAll() (Permissions, error) {
+	query := `
+		SELECT code
+		FROM permissions
+		ORDER BY code`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var permissions Permissions
+	for rows.Next() {
+		var permission string
+		err := rows.Scan(&permission)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return permissions, nil
 }
 
 func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
@@ -55,7 +81,21 @@ func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
 func (m PermissionModel) AddForUser(userID int64, codes ...string) error {
 	query := `
 		INSERT INTO users_permissions
-		SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)`
+		SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+		ON CONFLICT DO NOTHING`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
+	return err
+}
+
+func (m PermissionModel) RemoveForUser(userID int64, codes ...string) error {
+	query := `
+		DELETE FROM users_permissions
+		USING permissions
+		WHERE users_permissions.permission_id = permissions.id
+		AND users_permissions.user_id = $1
+		AND permissions.code = ANY($2)`
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
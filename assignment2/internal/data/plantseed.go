@@ -13,10 +13,17 @@ import (
 type Plantseed struct {
 	ID        int64     `json:"id"`
 	CreatedAt time.Time `json:"-"`
+	UpdatedAt time.Time `json:"-"`
 	Name      string    `json:"name"`
 	Family    string    `json:"family"`
 	Amount    int32     `json:"amount,omitempty"`
 	Price     int32     `json:"price,omitempty"`
+	Language  string    `json:"language"`
+}
+
+var SearchLanguages = []string{
+	"simple", "danish", "dutch", "english", "finnish", "french", "german", "hungarian",
+	"italian", "norwegian", "portuguese", "romanian", "russian", "spanish", "swedish", "turkish",
 }
 
 func ValidateMovie(v *validator.Validator, plantseed *Plantseed) {
@@ -28,21 +35,30 @@ func ValidateMovie(v *validator.Validator, plantseed *Plantseed) {
 	v.Check(plantseed.Amount >= 0, "amount", "must be greater than 0")
 	v.Check(plantseed.Price != 0, "price", "must be provided")
 	v.Check(plantseed.Price >= 0, "price", "must be greater than 0")
+	v.Check(validator.In(plantseed.Language, SearchLanguages...), "language", "unsupported language")
+}
+
+var PlantseedFilterSchema = FilterSchema{
+	"id":     {Column: "id", Type: FilterNumber},
+	"name":   {Column: "name", Type: FilterText, Config: "language"},
+	"family": {Column: "family", Type: FilterText, Config: "language"},
+	"amount": {Column: "amount", Type: FilterNumber},
+	"price":  {Column: "price", Type: FilterNumber},
 }
 
 type PlantseedModel struct {
-	DB *sql.DB
+	DB DBTX
 }
 
 func (m PlantseedModel) Insert(plantseed *Plantseed) error {
 	query := `
-		INSERT INTO plantseed (name, family, amount, price)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, created_at`
-	args := []interface{}{plantseed.Name, plantseed.Family, plantseed.Amount, plantseed.Price}
+		INSERT INTO plantseed (name, family, amount, price, language)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at`
+	args := []interface{}{plantseed.Name, plantseed.Family, plantseed.Amount, plantseed.Price, plantseed.Language}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&plantseed.ID, &plantseed.CreatedAt)
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&plantseed.ID, &plantseed.CreatedAt, &plantseed.UpdatedAt)
 }
 
 func (m PlantseedModel) Get(id int64) (*Plantseed, error) {
@@ -50,7 +66,7 @@ func (m PlantseedModel) Get(id int64) (*Plantseed, error) {
 		return nil, ErrRecordNotFound
 	}
 	query := `
-	SELECT id, created_at, name, family, amount, price
+	SELECT id, created_at, name, family, amount, price, language::text
 	FROM plantseed
 	WHERE id = $1`
 	var plantseed Plantseed
@@ -63,6 +79,7 @@ func (m PlantseedModel) Get(id int64) (*Plantseed, error) {
 		&plantseed.Family,
 		&plantseed.Amount,
 		&plantseed.Price,
+		&plantseed.Language,
 	)
 	if err != nil {
 		switch {
@@ -78,18 +95,20 @@ func (m PlantseedModel) Get(id int64) (*Plantseed, error) {
 func (m PlantseedModel) Update(plantseed *Plantseed) error {
 	query := `
 	UPDATE plantseed
-	SET name = $1, family = $2, amount = $3, price = $4
-	WHERE id = $5`
+	SET name = $1, family = $2, amount = $3, price = $4, language = $5, updated_at = NOW()
+	WHERE id = $6
+	RETURNING updated_at`
 	args := []interface{}{
 		plantseed.Name,
 		plantseed.Family,
 		plantseed.Amount,
 		plantseed.Price,
+		plantseed.Language,
 		plantseed.ID,
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan()
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&plantseed.UpdatedAt)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -124,17 +143,56 @@ func (m PlantseedModel) Delete(id int64) error {
 	return nil
 }
 
+func (p *Plantseed) sortValue(column string) interface{} {
+	switch column {
+	case "id":
+		return p.ID
+	case "name":
+		return p.Name
+	case "family":
+		return p.Family
+	case "amount":
+		return p.Amount
+	case "price":
+		return p.Price
+	}
+	panic("unknown plantseed sort column: " + column)
+}
+
+func plantseedConditions(name string, family string, filters Filters) (string, []interface{}) {
+	args := []interface{}{name, family}
+	config := "language"
+	if filters.Language != "" {
+		args = append(args, filters.Language)
+		config = "$3::regconfig"
+	}
+	conditions := fmt.Sprintf(`
+		WHERE (to_tsvector(%[1]s, name) @@ plainto_tsquery(%[1]s, $1) OR $1 = '')
+		AND (to_tsvector(%[1]s, family) @@ plainto_tsquery(%[1]s, $2) OR $2 = '')`, config)
+	if filters.Filter != "" {
+		condition, values := filters.filterCondition(len(args)+1, config)
+		conditions += "\n\t\tAND " + condition
+		args = append(args, values...)
+	}
+	return conditions, args
+}
+
 func (m PlantseedModel) GetAll(name string, family string, amount int, price int, filters Filters) ([]*Plantseed, Metadata, error) {
+	conditions, args := plantseedConditions(name, family, filters)
+	if filters.Cursor != "" {
+		condition, values := filters.cursorCondition(len(args) + 1)
+		conditions += "\n\t\tAND " + condition
+		args = append(args, values...)
+	}
+	args = append(args, filters.limit(), filters.offset())
 	query := fmt.Sprintf(`
-		SELECT  count(*) OVER(), id, created_at, name, family, amount, price
+		SELECT  count(*) OVER(), id, created_at, name, family, amount, price, language::text
 		FROM plantseed
-		WHERE (to_tsvector('simple', name) @@ plainto_tsquery('simple', $1) OR $1 = '')
-		AND (to_tsvector('simple', family) @@ plainto_tsquery('simple', $2) OR $2 = '')
-		ORDER  BY %s %s, id ASC
-		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+		%s
+		ORDER  BY %s
+		LIMIT $%d OFFSET $%d`, conditions, filters.orderBy(), len(args)-1, len(args))
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	args := []interface{}{name, family, filters.limit(), filters.offset()}
 
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -154,6 +212,7 @@ func (m PlantseedModel) GetAll(name string, family string, amount int, price int
 			&plantseed.Family,
 			&plantseed.Amount,
 			&plantseed.Price,
+			&plantseed.Language,
 		)
 		if err != nil {
 			return nil, Metadata{}, err
@@ -164,6 +223,65 @@ func (m PlantseedModel) GetAll(name string, family string, amount int, price int
 	if err = rows.Err(); err != nil {
 		return nil, Metadata{}, err
 	}
-	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	var metadata Metadata
+	if filters.Cursor != "" {
+		metadata = calculateCursorMetadata(filters.PageSize)
+	} else {
+		metadata = calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	}
+	if len(plantseeds) == filters.limit() {
+		last := plantseeds[len(plantseeds)-1]
+		keys := filters.sortKeys()
+		values := make([]interface{}, len(keys))
+		for i, key := range keys {
+			values[i] = last.sortValue(key.column)
+		}
+		metadata.NextCursor = encodeCursor(filters.Sort, values)
+	}
 	return plantseeds, metadata, nil
 }
+
+func (m PlantseedModel) GetNewMatches(name string, family string, filters Filters, searchID int64, since time.Time, limit int) ([]*Plantseed, error) {
+	conditions, args := plantseedConditions(name, family, filters)
+	args = append(args, since, searchID, limit)
+	query := fmt.Sprintf(`
+		SELECT id, created_at, updated_at, name, family, amount, price, language::text
+		FROM plantseed
+		%s
+		AND updated_at >= $%d::timestamptz - interval '1 minute'
+		AND NOT EXISTS (
+			SELECT 1 FROM saved_search_notifications
+			WHERE saved_search_id = $%d AND plantseed_id = plantseed.id
+		)
+		ORDER BY updated_at ASC, id ASC
+		LIMIT $%d`, conditions, len(args)-2, len(args)-1, len(args))
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	plantseeds := []*Plantseed{}
+	for rows.Next() {
+		var plantseed Plantseed
+		err := rows.Scan(
+			&plantseed.ID,
+			&plantseed.CreatedAt,
+			&plantseed.UpdatedAt,
+			&plantseed.Name,
+			&plantseed.Family,
+			&plantseed.Amount,
+			&plantseed.Price,
+			&plantseed.Language,
+		)
+		if err != nil {
+			return nil, err
+		}
+		plantseeds = append(plantseeds, &plantseed)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return plantseeds, nil
+}
@@ -0,0 +1,208 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"golang.assignment2.com/internal/validator"
+)
+
+const MaxSavedSearchesPerUser = 25
+
+type SavedSearch struct {
+	ID             int64      `json:"id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UserID         int64      `json:"-"`
+	Name           string     `json:"name"`
+	Query          string     `json:"query"`
+	LastSeenAt     time.Time  `json:"-"`
+	LastNotifiedAt *time.Time `json:"last_notified_at,omitempty"`
+	Version        int        `json:"-"`
+}
+
+type SavedSearchSubscriber struct {
+	UserID   int64
+	Name     string
+	Email    string
+	Searches []*SavedSearch
+}
+
+func ValidateSavedSearch(v *validator.Validator, search *SavedSearch) {
+	v.Check(search.Name != "", "name", "must be provided")
+	v.Check(len(search.Name) <= 500, "name", "must not be more than 500 bytes long")
+	v.Check(len(search.Query) <= 2000, "query", "must not be more than 2000 bytes long")
+}
+
+type SavedSearchModel struct {
+	DB DBTX
+}
+
+func (m SavedSearchModel) Insert(search *SavedSearch) error {
+	query := `
+	INSERT INTO saved_searches (user_id, name, query)
+	VALUES ($1, $2, $3)
+	RETURNING id, created_at, last_seen_at, version`
+	args := []interface{}{search.UserID, search.Name, search.Query}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&search.ID, &search.CreatedAt, &search.LastSeenAt, &search.Version)
+}
+
+func (m SavedSearchModel) CountForUser(userID int64) (int, error) {
+	query := `
+	SELECT count(*)
+	FROM saved_searches
+	WHERE user_id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var count int
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
+
+func (m SavedSearchModel) GetAllForUser(userID int64) ([]*SavedSearch, error) {
+	query := `
+	SELECT id, created_at, user_id, name, query, last_seen_at, last_notified_at, version
+	FROM saved_searches
+	WHERE user_id = $1
+	ORDER BY id ASC`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	searches := []*SavedSearch{}
+	for rows.Next() {
+		var search SavedSearch
+		err := rows.Scan(
+			&search.ID,
+			&search.CreatedAt,
+			&search.UserID,
+			&search.Name,
+			&search.Query,
+			&search.LastSeenAt,
+			&search.LastNotifiedAt,
+			&search.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		searches = append(searches, &search)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return searches, nil
+}
+
+func (m SavedSearchModel) GetSubscribers() ([]*SavedSearchSubscriber, error) {
+	query := `
+	SELECT saved_searches.id, saved_searches.created_at, saved_searches.user_id, saved_searches.name,
+		saved_searches.query, saved_searches.last_seen_at, saved_searches.last_notified_at, saved_searches.version,
+		users.name, users.email
+	FROM saved_searches
+	INNER JOIN users ON users.id = saved_searches.user_id
+	WHERE users.activated = true AND users.disabled_at IS NULL
+	ORDER BY saved_searches.user_id ASC, saved_searches.id ASC`
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	subscribers := []*SavedSearchSubscriber{}
+	var current *SavedSearchSubscriber
+	for rows.Next() {
+		var search SavedSearch
+		var name, email string
+		err := rows.Scan(
+			&search.ID,
+			&search.CreatedAt,
+			&search.UserID,
+			&search.Name,
+			&search.Query,
+			&search.LastSeenAt,
+			&search.LastNotifiedAt,
+			&search.Version,
+			&name,
+			&email,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if current == nil || current.UserID != search.UserID {
+			current = &SavedSearchSubscriber{UserID: search.UserID, Name: name, Email: email}
+			subscribers = append(subscribers, current)
+		}
+		current.Searches = append(current.Searches, &search)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return subscribers, nil
+}
+
+func (m SavedSearchModel) UpdateWatermark(search *SavedSearch, plantseeds []*Plantseed) error {
+	ids := make([]int64, 0, len(plantseeds))
+	lastSeenAt := search.LastSeenAt
+	for _, plantseed := range plantseeds {
+		ids = append(ids, plantseed.ID)
+		if plantseed.UpdatedAt.After(lastSeenAt) {
+			lastSeenAt = plantseed.UpdatedAt
+		}
+	}
+	query := `
+	WITH notified AS (
+		INSERT INTO saved_search_notifications (saved_search_id, plantseed_id)
+		SELECT saved_searches.id, plantseed_ids.id
+		FROM saved_searches, unnest($4::bigint[]) AS plantseed_ids(id)
+		WHERE saved_searches.id = $2
+		ON CONFLICT DO NOTHING
+	)
+	UPDATE saved_searches
+	SET last_seen_at = GREATEST(last_seen_at, $1), last_notified_at = NOW(), version = version + 1
+	WHERE id = $2 AND version = $3
+	RETURNING last_seen_at, last_notified_at, version`
+	args := []interface{}{lastSeenAt, search.ID, search.Version, pq.Array(ids)}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&search.LastSeenAt, &search.LastNotifiedAt, &search.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m SavedSearchModel) Delete(id, userID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+	DELETE FROM saved_searches
+	WHERE id = $1 AND user_id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
@@ -6,14 +6,20 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base32"
+	"errors"
 	"time"
 
 	"golang.assignment2.com/internal/validator"
 )
 
 const (
-	ScopeActivation     = "activation"
-	ScopeAuthentication = "authentication" 
+	ScopeActivation        = "activation"
+	ScopeAuthentication    = "authentication" 
+	ScopePasswordReset     = "password-reset"
+	ScopeEmailChange       = "email-change"
+	ScopeEmailChangeCancel = "email-change-cancel"
+	ScopeRefresh           = "refresh"
+	ScopeTwoFactor         = "two-factor"
 )
 
 type Token struct {
@@ -22,6 +28,19 @@ type Token struct {
 	UserID    int64     `json:"-"`
 	Expiry    time.Time `json:"expiry"`
 	Scope     string    `json:"-"`
+	IP        string    `json:"-"`
+	UserAgent string    `json:"-"`
+	Family    int64     `json:"-"`
+}
+
+type Session struct {
+	ID         int64      `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Expiry     time.Time  `json:"expiry"`
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"user_agent"`
+	Current    bool       `json:"current"`
 }
 
 func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
@@ -47,7 +66,7 @@ func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
 }
 
 type TokenModel struct {
-	DB *sql.DB
+	DB DBTX
 }
 
 func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token, error) {
@@ -59,11 +78,106 @@ func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token,
 	return token, err
 }
 
+func (m TokenModel) newFamily() (int64, error) {
+	var family int64
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, `SELECT nextval('token_families_seq')`).Scan(&family)
+	return family, err
+}
+
+func (m TokenModel) NewRefresh(userID, family int64, ttl time.Duration, ip, userAgent string) (*Token, error) {
+	token, err := generateToken(userID, ttl, ScopeRefresh)
+	if err != nil {
+		return nil, err
+	}
+	if family == 0 {
+		family, err = m.newFamily()
+		if err != nil {
+			return nil, err
+		}
+	}
+	token.IP = ip
+	token.UserAgent = userAgent
+	token.Family = family
+	err = m.Insert(token)
+	return token, err
+}
+
+func (m TokenModel) NewSession(userID, family int64, accessTTL, refreshTTL time.Duration, ip, userAgent string) (*Token, *Token, error) {
+	refresh, err := m.NewRefresh(userID, family, refreshTTL, ip, userAgent)
+	if err != nil {
+		return nil, nil, err
+	}
+	access, err := generateToken(userID, accessTTL, ScopeAuthentication)
+	if err != nil {
+		return nil, nil, err
+	}
+	access.IP = ip
+	access.UserAgent = userAgent
+	access.Family = refresh.Family
+	err = m.Insert(access)
+	if err != nil {
+		return nil, nil, err
+	}
+	return access, refresh, nil
+}
+
+func (m TokenModel) GetRefresh(tokenPlaintext string) (*Token, bool, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	query := `
+	SELECT hash, user_id, expiry, family, used_at IS NOT NULL
+	FROM tokens
+	WHERE hash = $1 AND scope = $2 AND expiry > $3
+	FOR UPDATE`
+	token := Token{Plaintext: tokenPlaintext, Scope: ScopeRefresh}
+	var used bool
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, tokenHash[:], ScopeRefresh, time.Now()).Scan(
+		&token.Hash,
+		&token.UserID,
+		&token.Expiry,
+		&token.Family,
+		&used,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, false, ErrRecordNotFound
+		default:
+			return nil, false, err
+		}
+	}
+	return &token, used, nil
+}
+
+func (m TokenModel) MarkUsed(token *Token) error {
+	query := `
+	UPDATE tokens
+	SET used_at = NOW()
+	WHERE hash = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, token.Hash)
+	return err
+}
+
+func (m TokenModel) DeleteFamily(family int64) error {
+	query := `
+	DELETE FROM tokens
+	WHERE family = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, family)
+	return err
+}
+
 func (m TokenModel) Insert(token *Token) error {
 	query := `
-	INSERT INTO tokens (hash, user_id, expiry, scope)
-	VALUES ($1, $2, $3, $4)`
-	args := []interface{}{token.Hash, token.UserID, token.Expiry, token.Scope}
+	INSERT INTO tokens (hash, user_id, expiry, scope, ip, user_agent, family)
+	VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0))`
+	args := []interface{}{token.Hash, token.UserID, token.Expiry, token.Scope, token.IP, token.UserAgent, token.Family}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	_, err := m.DB.ExecContext(ctx, query, args...)
@@ -79,3 +193,137 @@ func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
 	_, err := m.DB.ExecContext(ctx, query, scope, userID)
 	return err
 }
+
+func (m TokenModel) NewEmailChange(userID int64, ttl time.Duration, email string) (*Token, error) {
+	token, err := generateToken(userID, ttl, ScopeEmailChange)
+	if err != nil {
+		return nil, err
+	}
+	query := `
+	WITH token AS (
+		INSERT INTO tokens (hash, user_id, expiry, scope)
+		VALUES ($1, $2, $3, $4)
+		RETURNING hash
+	)
+	INSERT INTO email_changes (token_hash, email)
+	SELECT hash, $5 FROM token`
+	args := []interface{}{token.Hash, token.UserID, token.Expiry, token.Scope, email}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err = m.DB.ExecContext(ctx, query, args...)
+	return token, err
+}
+
+func (m TokenModel) Touch(tokenPlaintext, ip, userAgent string) (int64, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	query := `
+	WITH touched AS (
+		UPDATE tokens
+		SET last_used_at = NOW(), ip = $2, user_agent = $3
+		WHERE hash = $1
+		AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute' OR ip <> $2 OR user_agent <> $3)
+	)
+	SELECT COALESCE(family, 0) FROM tokens WHERE hash = $1`
+	var family int64
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, tokenHash[:], ip, userAgent).Scan(&family)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+	return family, nil
+}
+
+func (m TokenModel) GetSessions(userID, currentFamily int64) ([]*Session, error) {
+	query := `
+	SELECT family, min(created_at), max(last_used_at), max(expiry) FILTER (WHERE used_at IS NULL),
+		(array_agg(ip ORDER BY COALESCE(last_used_at, created_at) DESC, id DESC))[1],
+		(array_agg(user_agent ORDER BY COALESCE(last_used_at, created_at) DESC, id DESC))[1],
+		family = $4
+	FROM tokens
+	WHERE user_id = $1 AND scope IN ($2, $3) AND family IS NOT NULL
+	GROUP BY family
+	HAVING bool_or(used_at IS NULL AND expiry > NOW())
+	ORDER BY min(created_at) DESC, family DESC`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID, ScopeAuthentication, ScopeRefresh, currentFamily)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	sessions := []*Session{}
+	for rows.Next() {
+		var session Session
+		err := rows.Scan(
+			&session.ID,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.Expiry,
+			&session.IP,
+			&session.UserAgent,
+			&session.Current,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &session)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (m TokenModel) DeleteSession(family, userID int64) error {
+	if family < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+	DELETE FROM tokens
+	WHERE family = $1 AND user_id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, family, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (m TokenModel) DeleteOtherSessions(userID, currentFamily int64) ([]int64, error) {
+	query := `
+	WITH deleted AS (
+		DELETE FROM tokens
+		WHERE user_id = $1 AND scope IN ($2, $3) AND family IS DISTINCT FROM $4
+		RETURNING family
+	)
+	SELECT DISTINCT family FROM deleted WHERE family IS NOT NULL`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID, ScopeAuthentication, ScopeRefresh, currentFamily)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	families := []int64{}
+	for rows.Next() {
+		var family int64
+		err := rows.Scan(&family)
+		if err != nil {
+			return nil, err
+		}
+		families = append(families, family)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return families, nil
+}
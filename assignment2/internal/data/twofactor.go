@@ -0,0 +1,189 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+)
+
+const RecoveryCodeCount = 10
+
+type TwoFactor struct {
+	UserID       int64     `json:"-"`
+	Secret       []byte    `json:"-"`
+	Confirmed    bool      `json:"enabled"`
+	LastUsedStep int64     `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
+
+func hashRecoveryCode(code string) []byte {
+	hash := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+	return hash[:]
+}
+
+func generateRecoveryCode() (string, error) {
+	randomBytes := make([]byte, 5)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+	code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes))
+	return code[:4] + "-" + code[4:], nil
+}
+
+type TwoFactorModel struct {
+	DB DBTX
+}
+
+func (m TwoFactorModel) Get(userID int64) (*TwoFactor, error) {
+	query := `
+	SELECT user_id, secret, confirmed, last_used_step, created_at
+	FROM user_totp
+	WHERE user_id = $1`
+	var tf TwoFactor
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(
+		&tf.UserID,
+		&tf.Secret,
+		&tf.Confirmed,
+		&tf.LastUsedStep,
+		&tf.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &tf, nil
+}
+
+func (m TwoFactorModel) Upsert(tf *TwoFactor) error {
+	query := `
+	INSERT INTO user_totp (user_id, secret)
+	VALUES ($1, $2)
+	ON CONFLICT (user_id) DO UPDATE
+	SET secret = EXCLUDED.secret, confirmed = false, last_used_step = 0, created_at = NOW()
+	WHERE user_totp.confirmed = false
+	RETURNING confirmed, last_used_step, created_at`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, tf.UserID, tf.Secret).Scan(&tf.Confirmed, &tf.LastUsedStep, &tf.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m TwoFactorModel) Confirm(userID, step int64) error {
+	query := `
+	UPDATE user_totp
+	SET confirmed = true, last_used_step = $2
+	WHERE user_id = $1 AND confirmed = false`
+	return m.exec(query, userID, step)
+}
+
+func (m TwoFactorModel) UseStep(userID, step int64) error {
+	query := `
+	UPDATE user_totp
+	SET last_used_step = $2
+	WHERE user_id = $1 AND confirmed = true AND last_used_step < $2`
+	return m.exec(query, userID, step)
+}
+
+func (m TwoFactorModel) Delete(userID int64) error {
+	query := `
+	WITH codes AS (
+		DELETE FROM recovery_codes
+		WHERE user_id = $1
+	)
+	DELETE FROM user_totp
+	WHERE user_id = $1`
+	return m.exec(query, userID)
+}
+
+func (m TwoFactorModel) exec(query string, args ...interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (m TwoFactorModel) ReplaceRecoveryCodes(userID int64) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	query := `
+	DELETE FROM recovery_codes
+	WHERE user_id = $1`
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	query = `
+	INSERT INTO recovery_codes (user_id, hash)
+	VALUES ($1, $2)`
+	codes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		codes[i], err = generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		_, err = m.DB.ExecContext(ctx, query, userID, hashRecoveryCode(codes[i]))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+func (m TwoFactorModel) UseRecoveryCode(userID int64, code string) error {
+	query := `
+	UPDATE recovery_codes
+	SET used_at = NOW()
+	WHERE id = (
+		SELECT id FROM recovery_codes
+		WHERE user_id = $1 AND hash = $2 AND used_at IS NULL
+		LIMIT 1
+		FOR UPDATE
+	)`
+	return m.exec(query, userID, hashRecoveryCode(code))
+}
+
+func (m TwoFactorModel) CountRecoveryCodes(userID int64) (int, error) {
+	query := `
+	SELECT count(*)
+	FROM recovery_codes
+	WHERE user_id = $1 AND used_at IS NULL`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var count int
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
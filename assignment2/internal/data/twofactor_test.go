@@ -0,0 +1,30 @@
+package data
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+)
+
+func TestRecoveryCodes(t *testing.T) {
+	rx := regexp.MustCompile(`^[a-z2-7]{4}-[a-z2-7]{4}$`)
+	code, err := generateRecoveryCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rx.MatchString(code) {
+		t.Errorf("unexpected recovery code format %q", code)
+	}
+	for _, variant := range []string{code, " " + code + " ", code[:4] + code[5:], "  " + string(bytes.ToUpper([]byte(code)))} {
+		if !bytes.Equal(hashRecoveryCode(variant), hashRecoveryCode(code)) {
+			t.Errorf("variant %q of %q does not hash to the same value", variant, code)
+		}
+	}
+	other, err := generateRecoveryCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(hashRecoveryCode(other), hashRecoveryCode(code)) {
+		t.Errorf("distinct codes %q and %q hash to the same value", code, other)
+	}
+}
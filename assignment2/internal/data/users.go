@@ -5,6 +5,7 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"errors"
+	"fmt"
 	"time"
 
 	"golang.assignment2.com/internal/validator"
@@ -18,19 +19,24 @@ var (
 var AnonymousUser = &User{}
 
 type User struct {
-	ID        int64     `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	Password  password  `json:"-"`
-	Activated bool      `json:"activated"`
-	Version   int       `json:"-"`
+	ID         int64      `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Name       string     `json:"name"`
+	Email      string     `json:"email"`
+	Password   password   `json:"-"`
+	Activated  bool       `json:"activated"`
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+	Version    int        `json:"-"`
 }
 
 func (u *User) IsAnonymous() bool {
 	return u == AnonymousUser
 }
 
+func (u *User) Disabled() bool {
+	return u.DisabledAt != nil
+}
+
 type password struct {
 	plaintext *string
 	hash      []byte
@@ -81,7 +87,7 @@ func ValidateUser(v *validator.Validator, user *User) {
 }
 
 type UserModel struct {
-	DB *sql.DB
+	DB DBTX
 }
 
 func (m UserModel) Insert(user *User) error {
@@ -104,9 +110,84 @@ func (m UserModel) Insert(user *User) error {
 	return nil
 }
 
+func (m UserModel) Get(id int64) (*User, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+	SELECT id, created_at, name, email, password_hash, activated, disabled_at, version
+	FROM users
+	WHERE id = $1`
+	var user User
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.DisabledAt,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+func (m UserModel) GetAll(search string, activated *bool, filters Filters) ([]*User, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), id, created_at, name, email, password_hash, activated, disabled_at, version
+	FROM users
+	WHERE (strpos(lower(name), lower($1)) > 0 OR strpos(lower(email::text), lower($1)) > 0 OR $1 = '')
+	AND (activated = $2 OR $2 IS NULL)
+	ORDER BY %s
+	LIMIT $3 OFFSET $4`, filters.orderBy())
+	args := []interface{}{search, activated, filters.limit(), filters.offset()}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+	totalRecords := 0
+	users := []*User{}
+	for rows.Next() {
+		var user User
+		err := rows.Scan(
+			&totalRecords,
+			&user.ID,
+			&user.CreatedAt,
+			&user.Name,
+			&user.Email,
+			&user.Password.hash,
+			&user.Activated,
+			&user.DisabledAt,
+			&user.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		users = append(users, &user)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return users, metadata, nil
+}
+
 func (m UserModel) GetByEmail(email string) (*User, error) {
 	query := `
-	SELECT id, created_at, name, email, password_hash, activated, version
+	SELECT id, created_at, name, email, password_hash, activated, disabled_at, version
 	FROM users
 	WHERE email = $1`
 	var user User
@@ -119,6 +200,7 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.DisabledAt,
 		&user.Version,
 	)
 	if err != nil {
@@ -135,14 +217,15 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 func (m UserModel) Update(user *User) error {
 	query := `
 	UPDATE users
-	SET name = $1, email = $2, password_hash = $3, activated = $4, version = version + 1
-	WHERE id = $5 AND version = $6
+	SET name = $1, email = $2, password_hash = $3, activated = $4, disabled_at = $5, version = version + 1
+	WHERE id = $6 AND version = $7
 	RETURNING version`
 	args := []interface{}{
 		user.Name,
 		user.Email,
 		user.Password.hash,
 		user.Activated,
+		user.DisabledAt,
 		user.ID,
 		user.Version,
 	}
@@ -165,7 +248,7 @@ func (m UserModel) Update(user *User) error {
 func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error) {
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 	query := `
-	SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
+	SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.disabled_at, users.version
 	FROM users
 	INNER JOIN tokens
 	ON users.id = tokens.user_id
@@ -183,6 +266,7 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.DisabledAt,
 		&user.Version,
 	)
 	if err != nil {
@@ -195,3 +279,62 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 	}
 	return &user, nil
 }
+
+func (m UserModel) Delete(id int64) error {
+	query := `
+	DELETE FROM users
+	WHERE id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (m UserModel) GetForEmailChange(tokenPlaintext string) (*User, string, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	query := `
+	SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.disabled_at, users.version, email_changes.email
+	FROM users
+	INNER JOIN tokens
+	ON users.id = tokens.user_id
+	INNER JOIN email_changes
+	ON tokens.hash = email_changes.token_hash
+	WHERE tokens.hash = $1
+	AND tokens.scope = $2
+	AND tokens.expiry > $3`
+	args := []interface{}{tokenHash[:], ScopeEmailChange, time.Now()}
+	var user User
+	var email string
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.DisabledAt,
+		&user.Version,
+		&email,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, "", ErrRecordNotFound
+		default:
+			return nil, "", err
+		}
+	}
+	return &user, email, nil
+}
@@ -0,0 +1,451 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/lib/pq"
+	"golang.assignment2.com/internal/validator"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryDead      = "dead"
+)
+
+var DeliveryStatuses = []string{DeliveryPending, DeliverySucceeded, DeliveryDead}
+
+type Webhook struct {
+	ID         int64     `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	UserID     int64     `json:"-"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"-"`
+	EventTypes []string  `json:"event_types"`
+	Active     bool      `json:"active"`
+	Version    int       `json:"-"`
+}
+
+type WebhookDelivery struct {
+	ID                 int64           `json:"id"`
+	CreatedAt          time.Time       `json:"created_at"`
+	WebhookID          int64           `json:"webhook_id"`
+	EventID            int64           `json:"event_id"`
+	EventType          string          `json:"event_type"`
+	Payload            json.RawMessage `json:"payload"`
+	Status             string          `json:"status"`
+	Attempts           int             `json:"attempts"`
+	NextAttemptAt      time.Time       `json:"next_attempt_at"`
+	LastAttemptAt      *time.Time      `json:"last_attempt_at,omitempty"`
+	LastResponseStatus int             `json:"last_response_status,omitempty"`
+	LastError          string          `json:"last_error,omitempty"`
+	URL                string          `json:"-"`
+	Secret             string          `json:"-"`
+}
+
+type WebhookDeliveryAttempt struct {
+	ID             int64     `json:"id"`
+	AttemptedAt    time.Time `json:"attempted_at"`
+	ResponseStatus int       `json:"response_status,omitempty"`
+	Error          string    `json:"error,omitempty"`
+}
+
+func ValidateWebhook(v *validator.Validator, webhook *Webhook, eventTypes []string) {
+	v.Check(webhook.URL != "", "url", "must be provided")
+	v.Check(len(webhook.URL) <= 2000, "url", "must not be more than 2000 bytes long")
+	u, err := url.Parse(webhook.URL)
+	v.Check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "url", "must be an absolute http or https URL")
+	if err == nil {
+		if ip := net.ParseIP(u.Hostname()); ip != nil {
+			v.Check(WebhookAddressAllowed(ip), "url", "must not point to a loopback, private, link-local or multicast address")
+		}
+	}
+	v.Check(len(webhook.Secret) >= 16, "secret", "must be at least 16 bytes long")
+	v.Check(len(webhook.Secret) <= 256, "secret", "must not be more than 256 bytes long")
+	v.Check(len(webhook.EventTypes) > 0, "event_types", "must contain at least 1 event type")
+	v.Check(validator.Unique(webhook.EventTypes), "event_types", "must not contain duplicate values")
+	for _, eventType := range webhook.EventTypes {
+		v.Check(validator.In(eventType, eventTypes...), "event_types", fmt.Sprintf("unsupported event type %q", eventType))
+	}
+}
+
+func WebhookAddressAllowed(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified())
+}
+
+type WebhookModel struct {
+	DB DBTX
+}
+
+func (m WebhookModel) Insert(webhook *Webhook) error {
+	query := `
+	INSERT INTO webhooks (user_id, url, secret, event_types, active)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at, version`
+	args := []interface{}{webhook.UserID, webhook.URL, webhook.Secret, pq.Array(webhook.EventTypes), webhook.Active}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&webhook.ID, &webhook.CreatedAt, &webhook.Version)
+}
+
+func (m WebhookModel) Get(id, userID int64) (*Webhook, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+	SELECT id, created_at, user_id, url, secret, event_types, active, version
+	FROM webhooks
+	WHERE id = $1 AND user_id = $2`
+	var webhook Webhook
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(
+		&webhook.ID,
+		&webhook.CreatedAt,
+		&webhook.UserID,
+		&webhook.URL,
+		&webhook.Secret,
+		pq.Array(&webhook.EventTypes),
+		&webhook.Active,
+		&webhook.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &webhook, nil
+}
+
+func (m WebhookModel) GetAllForUser(userID int64) ([]*Webhook, error) {
+	query := `
+	SELECT id, created_at, user_id, url, secret, event_types, active, version
+	FROM webhooks
+	WHERE user_id = $1
+	ORDER BY id ASC`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	webhooks := []*Webhook{}
+	for rows.Next() {
+		var webhook Webhook
+		err := rows.Scan(
+			&webhook.ID,
+			&webhook.CreatedAt,
+			&webhook.UserID,
+			&webhook.URL,
+			&webhook.Secret,
+			pq.Array(&webhook.EventTypes),
+			&webhook.Active,
+			&webhook.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, &webhook)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func (m WebhookModel) Update(webhook *Webhook) error {
+	query := `
+	UPDATE webhooks
+	SET url = $1, secret = $2, event_types = $3, active = $4, version = version + 1
+	WHERE id = $5 AND user_id = $6 AND version = $7
+	RETURNING version`
+	args := []interface{}{
+		webhook.URL,
+		webhook.Secret,
+		pq.Array(webhook.EventTypes),
+		webhook.Active,
+		webhook.ID,
+		webhook.UserID,
+		webhook.Version,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&webhook.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m WebhookModel) Delete(id, userID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+	DELETE FROM webhooks
+	WHERE id = $1 AND user_id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (m WebhookModel) NextEventID() (int64, error) {
+	query := `SELECT nextval('event_id_seq')`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var id int64
+	err := m.DB.QueryRowContext(ctx, query).Scan(&id)
+	return id, err
+}
+
+func (m WebhookModel) Enqueue(eventID int64, eventType string, payload []byte) (int64, error) {
+	query := `
+	INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload)
+	SELECT id, $1, $2, $3
+	FROM webhooks
+	WHERE active = true AND $2 = ANY(event_types)`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, eventID, eventType, string(payload))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (m WebhookModel) ClaimDue(limit int, lease time.Duration) ([]*WebhookDelivery, error) {
+	query := `
+	UPDATE webhook_deliveries
+	SET next_attempt_at = NOW() + make_interval(secs => $2)
+	FROM webhooks
+	WHERE webhooks.id = webhook_deliveries.webhook_id
+	AND webhook_deliveries.id IN (
+		SELECT webhook_deliveries.id
+		FROM webhook_deliveries
+		INNER JOIN webhooks ON webhooks.id = webhook_deliveries.webhook_id
+		WHERE webhook_deliveries.status = 'pending' AND webhook_deliveries.next_attempt_at <= NOW()
+		AND webhooks.active = true
+		ORDER BY webhook_deliveries.next_attempt_at ASC
+		LIMIT $1
+		FOR UPDATE OF webhook_deliveries SKIP LOCKED
+	)
+	RETURNING webhook_deliveries.id, webhook_deliveries.created_at, webhook_deliveries.webhook_id,
+		webhook_deliveries.event_id, webhook_deliveries.event_type, webhook_deliveries.payload,
+		webhook_deliveries.status, webhook_deliveries.attempts, webhook_deliveries.next_attempt_at,
+		webhook_deliveries.last_attempt_at, webhook_deliveries.last_response_status,
+		webhook_deliveries.last_error, webhooks.url, webhooks.secret`
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		var delivery WebhookDelivery
+		err := rows.Scan(
+			&delivery.ID,
+			&delivery.CreatedAt,
+			&delivery.WebhookID,
+			&delivery.EventID,
+			&delivery.EventType,
+			(*[]byte)(&delivery.Payload),
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.NextAttemptAt,
+			&delivery.LastAttemptAt,
+			&delivery.LastResponseStatus,
+			&delivery.LastError,
+			&delivery.URL,
+			&delivery.Secret,
+		)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, &delivery)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func (m WebhookModel) RecordAttempt(delivery *WebhookDelivery) error {
+	query := `
+	WITH attempt AS (
+		INSERT INTO webhook_delivery_attempts (delivery_id, response_status, error)
+		SELECT id, $4, $5
+		FROM webhook_deliveries
+		WHERE id = $6
+	)
+	UPDATE webhook_deliveries
+	SET status = $1, attempts = $2, next_attempt_at = $3, last_attempt_at = NOW(),
+		last_response_status = $4, last_error = $5
+	WHERE id = $6
+	RETURNING last_attempt_at`
+	args := []interface{}{
+		delivery.Status,
+		delivery.Attempts,
+		delivery.NextAttemptAt,
+		delivery.LastResponseStatus,
+		delivery.LastError,
+		delivery.ID,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&delivery.LastAttemptAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m WebhookModel) GetDeliveries(webhookID int64, status string, filters Filters) ([]*WebhookDelivery, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), id, created_at, webhook_id, event_id, event_type, payload, status,
+		attempts, next_attempt_at, last_attempt_at, last_response_status, last_error
+	FROM webhook_deliveries
+	WHERE webhook_id = $1
+	AND (status = $2 OR $2 = '')
+	ORDER BY %s
+	LIMIT $3 OFFSET $4`, filters.orderBy())
+	args := []interface{}{webhookID, status, filters.limit(), filters.offset()}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+	totalRecords := 0
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		var delivery WebhookDelivery
+		err := rows.Scan(
+			&totalRecords,
+			&delivery.ID,
+			&delivery.CreatedAt,
+			&delivery.WebhookID,
+			&delivery.EventID,
+			&delivery.EventType,
+			(*[]byte)(&delivery.Payload),
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.NextAttemptAt,
+			&delivery.LastAttemptAt,
+			&delivery.LastResponseStatus,
+			&delivery.LastError,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		deliveries = append(deliveries, &delivery)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return deliveries, metadata, nil
+}
+
+func (m WebhookModel) GetAttempts(deliveryID, webhookID int64) ([]*WebhookDeliveryAttempt, error) {
+	query := `
+	SELECT webhook_delivery_attempts.id, webhook_delivery_attempts.attempted_at,
+		webhook_delivery_attempts.response_status, webhook_delivery_attempts.error
+	FROM webhook_delivery_attempts
+	INNER JOIN webhook_deliveries ON webhook_deliveries.id = webhook_delivery_attempts.delivery_id
+	WHERE webhook_delivery_attempts.delivery_id = $1 AND webhook_deliveries.webhook_id = $2
+	ORDER BY webhook_delivery_attempts.id ASC`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, deliveryID, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	attempts := []*WebhookDeliveryAttempt{}
+	for rows.Next() {
+		var attempt WebhookDeliveryAttempt
+		err := rows.Scan(&attempt.ID, &attempt.AttemptedAt, &attempt.ResponseStatus, &attempt.Error)
+		if err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, &attempt)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return attempts, nil
+}
+
+func (m WebhookModel) Redeliver(id, webhookID int64) (*WebhookDelivery, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+	UPDATE webhook_deliveries
+	SET status = 'pending', attempts = 0, next_attempt_at = NOW()
+	WHERE id = $1 AND webhook_id = $2
+	RETURNING id, created_at, webhook_id, event_id, event_type, payload, status,
+		attempts, next_attempt_at, last_attempt_at, last_response_status, last_error`
+	var delivery WebhookDelivery
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id, webhookID).Scan(
+		&delivery.ID,
+		&delivery.CreatedAt,
+		&delivery.WebhookID,
+		&delivery.EventID,
+		&delivery.EventType,
+		(*[]byte)(&delivery.Payload),
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.NextAttemptAt,
+		&delivery.LastAttemptAt,
+		&delivery.LastResponseStatus,
+		&delivery.LastError,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &delivery, nil
+}
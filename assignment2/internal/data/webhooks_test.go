@@ -0,0 +1,40 @@
+package data
+
+import (
+	"testing"
+
+	"golang.assignment2.com/internal/validator"
+)
+
+func TestValidateWebhookURL(t *testing.T) {
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{"https://example.com/hooks", true},
+		{"http://93.184.216.34:8080/hooks", true},
+		{"https://[2606:4700::1111]/hooks", true},
+		{"ftp://example.com/hooks", false},
+		{"/hooks", false},
+		{"http://127.0.0.1/hooks", false},
+		{"http://[::1]/hooks", false},
+		{"http://10.0.0.5/hooks", false},
+		{"http://172.16.3.4/hooks", false},
+		{"http://192.168.1.1/hooks", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"http://[fe80::1]/hooks", false},
+		{"http://[fd00::1]/hooks", false},
+		{"http://0.0.0.0/hooks", false},
+		{"http://224.0.0.1/hooks", false},
+		{"http://[::ffff:127.0.0.1]/hooks", false},
+	}
+	for _, tt := range tests {
+		v := validator.New()
+		webhook := &Webhook{URL: tt.url, Secret: "0123456789abcdef", EventTypes: []string{"plantseed.created"}}
+		ValidateWebhook(v, webhook, []string{"plantseed.created"})
+		_, invalid := v.Errors["url"]
+		if invalid == tt.valid {
+			t.Errorf("%s: got valid %t; want %t (%v)", tt.url, !invalid, tt.valid, v.Errors)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+const subscriberBuffer = 64
+
+var ErrClosed = errors.New("events: broker closed")
+
+type Event struct {
+	ID   int64           `json:"id"`
+	Type string          `json:"type"`
+	Time time.Time       `json:"time"`
+	Data json.RawMessage `json:"data"`
+}
+
+type Subscription struct {
+	Events   <-chan Event
+	Backlog  []Event
+	Complete bool
+	broker   *Broker
+	ch       chan Event
+}
+
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.broker.drop(s)
+}
+
+type Broker struct {
+	mu          sync.Mutex
+	size        int
+	log         []Event
+	lastID      int64
+	subscribers map[*Subscription]struct{}
+	closed      bool
+}
+
+func New(size int) *Broker {
+	return &Broker{
+		size:        size,
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+func (b *Broker) drop(s *Subscription) {
+	if _, ok := b.subscribers[s]; ok {
+		delete(b.subscribers, s)
+		close(s.ch)
+	}
+}
+
+func NewEvent(id int64, eventType string, data interface{}) (Event, error) {
+	js, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{ID: id, Type: eventType, Time: time.Now().UTC(), Data: js}, nil
+}
+
+func (b *Broker) Publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if event.ID > b.lastID {
+		b.lastID = event.ID
+	}
+	if len(b.log) >= b.size {
+		b.log = b.log[1:]
+	}
+	b.log = append(b.log, event)
+	for s := range b.subscribers {
+		select {
+		case s.ch <- event:
+		default:
+			b.drop(s)
+		}
+	}
+}
+
+func (b *Broker) Subscribe(lastEventID int64) (*Subscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, ErrClosed
+	}
+	ch := make(chan Event, subscriberBuffer)
+	s := &Subscription{Events: ch, Complete: true, broker: b, ch: ch}
+	if lastEventID > 0 {
+		oldest := b.lastID + 1
+		if len(b.log) > 0 {
+			oldest = b.log[0].ID
+		}
+		s.Complete = lastEventID >= oldest-1 && lastEventID <= b.lastID
+		for _, event := range b.log {
+			if event.ID > lastEventID {
+				s.Backlog = append(s.Backlog, event)
+			}
+		}
+	}
+	b.subscribers[s] = struct{}{}
+	return s, nil
+}
+
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for s := range b.subscribers {
+		b.drop(s)
+	}
+}
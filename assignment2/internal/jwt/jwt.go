@@ -0,0 +1,180 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	HS256 = "HS256"
+	EdDSA = "EdDSA"
+)
+
+var (
+	ErrInvalidToken = errors.New("jwt: invalid token")
+	ErrExpired      = errors.New("jwt: token expired")
+	ErrUnknownKey   = errors.New("jwt: unknown signing key")
+)
+
+var encoding = base64.RawURLEncoding
+
+type Claims struct {
+	Subject     string   `json:"sub"`
+	IssuedAt    int64    `json:"iat"`
+	IssuedAtMs  int64    `json:"iat_ms"`
+	ExpiresAt   int64    `json:"exp"`
+	Session     int64    `json:"sid"`
+	Activated   bool     `json:"activated"`
+	Permissions []string `json:"permissions"`
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid"`
+}
+
+type key struct {
+	secret  []byte
+	private ed25519.PrivateKey
+	public  ed25519.PublicKey
+}
+
+type Signer struct {
+	alg    string
+	active string
+	keys   map[string]key
+}
+
+func NewSigner(alg string, keys map[string][]byte, active string) (*Signer, error) {
+	s := &Signer{alg: alg, active: active, keys: make(map[string]key, len(keys))}
+	for kid, material := range keys {
+		switch alg {
+		case HS256:
+			if len(material) < 32 {
+				return nil, fmt.Errorf("jwt: key %q must be at least 32 bytes long", kid)
+			}
+			s.keys[kid] = key{secret: material}
+		case EdDSA:
+			if len(material) != ed25519.SeedSize {
+				return nil, fmt.Errorf("jwt: key %q must be a %d byte Ed25519 seed", kid, ed25519.SeedSize)
+			}
+			private := ed25519.NewKeyFromSeed(material)
+			s.keys[kid] = key{private: private, public: private.Public().(ed25519.PublicKey)}
+		default:
+			return nil, fmt.Errorf("jwt: unsupported algorithm %q", alg)
+		}
+	}
+	if _, ok := s.keys[active]; !ok {
+		return nil, fmt.Errorf("jwt: active key %q is not configured", active)
+	}
+	return s, nil
+}
+
+func (s *Signer) sign(k key, input string) []byte {
+	if s.alg == EdDSA {
+		return ed25519.Sign(k.private, []byte(input))
+	}
+	mac := hmac.New(sha256.New, k.secret)
+	mac.Write([]byte(input))
+	return mac.Sum(nil)
+}
+
+func (s *Signer) Sign(claims Claims) (string, error) {
+	h, err := json.Marshal(header{Alg: s.alg, Typ: "JWT", Kid: s.active})
+	if err != nil {
+		return "", err
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	input := encoding.EncodeToString(h) + "." + encoding.EncodeToString(c)
+	return input + "." + encoding.EncodeToString(s.sign(s.keys[s.active], input)), nil
+}
+
+func (s *Signer) Verify(token string, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+	var h header
+	if decode(parts[0], &h) != nil || h.Alg != s.alg {
+		return nil, ErrInvalidToken
+	}
+	k, ok := s.keys[h.Kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	signature, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	input := parts[0] + "." + parts[1]
+	switch s.alg {
+	case EdDSA:
+		ok = ed25519.Verify(k.public, []byte(input), signature)
+	default:
+		ok = hmac.Equal(s.sign(k, input), signature)
+	}
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	var claims Claims
+	if decode(parts[1], &claims) != nil {
+		return nil, ErrInvalidToken
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return nil, ErrExpired
+	}
+	return &claims, nil
+}
+
+func decode(segment string, dst interface{}) error {
+	js, err := encoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(js, dst)
+}
+
+type Denylist struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	revoked map[string]time.Time
+}
+
+func NewDenylist(ttl time.Duration) *Denylist {
+	return &Denylist{ttl: ttl, revoked: make(map[string]time.Time)}
+}
+
+func (d *Denylist) Revoke(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.revoked[key] = time.Now()
+}
+
+func (d *Denylist) Revoked(key string, issuedAt time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	revokedAt, ok := d.revoked[key]
+	return ok && !issuedAt.After(revokedAt)
+}
+
+func (d *Denylist) Prune() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for key, revokedAt := range d.revoked {
+		if time.Since(revokedAt) > d.ttl {
+			delete(d.revoked, key)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package jwt
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	hmacKeyA = bytes.Repeat([]byte("a"), 32)
+	hmacKeyB = bytes.Repeat([]byte("b"), 32)
+	seedA    = bytes.Repeat([]byte{1}, 32)
+	seedB    = bytes.Repeat([]byte{2}, 32)
+)
+
+func newTestSigner(t *testing.T, alg string, keys map[string][]byte, active string) *Signer {
+	t.Helper()
+	s, err := NewSigner(alg, keys, active)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func testClaims(now time.Time) Claims {
+	return Claims{
+		Subject:     "42",
+		IssuedAt:    now.Unix(),
+		ExpiresAt:   now.Add(15 * time.Minute).Unix(),
+		Session:     7,
+		Activated:   true,
+		Permissions: []string{"plantseed:read"},
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	now := time.Now()
+	for _, tt := range []struct {
+		alg  string
+		keys map[string][]byte
+	}{
+		{HS256, map[string][]byte{"a": hmacKeyA}},
+		{EdDSA, map[string][]byte{"a": seedA}},
+	} {
+		t.Run(tt.alg, func(t *testing.T) {
+			s := newTestSigner(t, tt.alg, tt.keys, "a")
+			token, err := s.Sign(testClaims(now))
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims, err := s.Verify(token, now)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if claims.Subject != "42" || claims.Session != 7 || !claims.Activated || len(claims.Permissions) != 1 {
+				t.Errorf("unexpected claims %+v", claims)
+			}
+		})
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	now := time.Now()
+	s := newTestSigner(t, HS256, map[string][]byte{"a": hmacKeyA}, "a")
+	token, err := s.Sign(testClaims(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(token, ".")
+	reheader := func(h header) string {
+		js, _ := json.Marshal(h)
+		return encoding.EncodeToString(js) + "." + parts[1] + "." + parts[2]
+	}
+	forged := testClaims(now)
+	forged.Permissions = append(forged.Permissions, "users:admin")
+	forgedJS, _ := json.Marshal(forged)
+	other := newTestSigner(t, HS256, map[string][]byte{"a": hmacKeyB}, "a")
+	otherToken, _ := other.Sign(testClaims(now))
+	ed := newTestSigner(t, EdDSA, map[string][]byte{"a": seedA}, "a")
+	edToken, _ := ed.Sign(testClaims(now))
+
+	tests := []struct {
+		name  string
+		token string
+		now   time.Time
+		err   error
+	}{
+		{"malformed", "abc.def", now, ErrInvalidToken},
+		{"tampered claims", parts[0] + "." + encoding.EncodeToString(forgedJS) + "." + parts[2], now, ErrInvalidToken},
+		{"tampered signature", parts[0] + "." + parts[1] + "." + encoding.EncodeToString([]byte("nope")), now, ErrInvalidToken},
+		{"alg none", reheader(header{Alg: "none", Typ: "JWT", Kid: "a"}), now, ErrInvalidToken},
+		{"alg mismatch", edToken, now, ErrInvalidToken},
+		{"unknown kid", reheader(header{Alg: HS256, Typ: "JWT", Kid: "z"}), now, ErrUnknownKey},
+		{"wrong key", otherToken, now, ErrInvalidToken},
+		{"expired", token, now.Add(15 * time.Minute), ErrExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.Verify(tt.token, tt.now)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("got error %v; want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	now := time.Now()
+	for _, tt := range []struct {
+		alg  string
+		a, b []byte
+	}{
+		{HS256, hmacKeyA, hmacKeyB},
+		{EdDSA, seedA, seedB},
+	} {
+		t.Run(tt.alg, func(t *testing.T) {
+			old := newTestSigner(t, tt.alg, map[string][]byte{"a": tt.a}, "a")
+			rotated := newTestSigner(t, tt.alg, map[string][]byte{"a": tt.a, "b": tt.b}, "b")
+			retired := newTestSigner(t, tt.alg, map[string][]byte{"b": tt.b}, "b")
+			oldToken, _ := old.Sign(testClaims(now))
+			newToken, _ := rotated.Sign(testClaims(now))
+			if _, err := rotated.Verify(oldToken, now); err != nil {
+				t.Errorf("rotated signer rejected token from previous key: %v", err)
+			}
+			if _, err := retired.Verify(newToken, now); err != nil {
+				t.Errorf("retired signer rejected token from active key: %v", err)
+			}
+			if _, err := retired.Verify(oldToken, now); !errors.Is(err, ErrUnknownKey) {
+				t.Errorf("got error %v; want %v", err, ErrUnknownKey)
+			}
+		})
+	}
+}
+
+func TestNewSignerErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		alg    string
+		keys   map[string][]byte
+		active string
+	}{
+		{"short hmac key", HS256, map[string][]byte{"a": []byte("short")}, "a"},
+		{"bad ed25519 seed", EdDSA, map[string][]byte{"a": []byte("short")}, "a"},
+		{"unsupported algorithm", "RS256", map[string][]byte{"a": hmacKeyA}, "a"},
+		{"missing active key", HS256, map[string][]byte{"a": hmacKeyA}, "b"},
+	}
+	for _, tt := range tests {
+		if _, err := NewSigner(tt.alg, tt.keys, tt.active); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func TestDenylist(t *testing.T) {
+	d := NewDenylist(time.Minute)
+	before := time.Now().Add(-time.Millisecond)
+	d.Revoke("user:1")
+	revokedAt := d.revoked["user:1"]
+	if !d.Revoked("user:1", before) {
+		t.Error("token issued before the revocation was not revoked")
+	}
+	if !d.Revoked("user:1", revokedAt) {
+		t.Error("token issued at the instant of the revocation was not revoked")
+	}
+	if !d.Revoked("user:1", time.UnixMilli(revokedAt.UnixMilli())) {
+		t.Error("token issued in the same millisecond as the revocation was not revoked")
+	}
+	if d.Revoked("user:1", revokedAt.Add(time.Millisecond)) {
+		t.Error("token issued after the revocation was revoked")
+	}
+	if d.Revoked("user:2", before) {
+		t.Error("unrelated key was revoked")
+	}
+}
+
+func TestDenylistPrune(t *testing.T) {
+	d := NewDenylist(time.Minute)
+	d.revoked["old"] = time.Now().Add(-2 * time.Minute)
+	d.Revoke("new")
+	d.Prune()
+	if _, ok := d.revoked["old"]; ok {
+		t.Error("expired entry was not pruned")
+	}
+	if _, ok := d.revoked["new"]; !ok {
+		t.Error("live entry was pruned")
+	}
+}
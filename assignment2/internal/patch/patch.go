@@ -0,0 +1,311 @@
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrMalformedPatch    = errors.New("malformed patch")
+	ErrInapplicablePatch = errors.New("patch cannot be applied")
+	ErrTestFailed        = errors.New("test operation failed")
+)
+
+func decode(data []byte) (interface{}, error) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	err := dec.Decode(&v)
+	if err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("must only contain a single JSON value")
+	}
+	return v, nil
+}
+
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+	p, err := decode(patch)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrMalformedPatch, err)
+	}
+	return json.Marshal(mergePatch(target, p))
+}
+
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+	for key, value := range p {
+		if value == nil {
+			delete(t, key)
+			continue
+		}
+		t[key] = mergePatch(t[key], value)
+	}
+	return t
+}
+
+type operation struct {
+	Op    string           `json:"op"`
+	Path  *string          `json:"path"`
+	From  *string          `json:"from"`
+	Value *json.RawMessage `json:"value"`
+}
+
+func Apply(doc, patch []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+	var ops []operation
+	err = json.Unmarshal(patch, &ops)
+	if err != nil {
+		return nil, fmt.Errorf("%w: must be a JSON array of operations", ErrMalformedPatch)
+	}
+	for i, op := range ops {
+		target, err = applyOperation(target, op)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s): %w", i, op.Op, err)
+		}
+	}
+	return json.Marshal(target)
+}
+
+func applyOperation(doc interface{}, op operation) (interface{}, error) {
+	if op.Path == nil {
+		return nil, fmt.Errorf("%w: missing path", ErrMalformedPatch)
+	}
+	path, err := parsePointer(*op.Path)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, fmt.Errorf("%w: missing value", ErrMalformedPatch)
+		}
+		value, err = decode(*op.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrMalformedPatch, err)
+		}
+	}
+	switch op.Op {
+	case "add":
+		return add(doc, path, value)
+	case "remove":
+		doc, _, err = remove(doc, path)
+		return doc, err
+	case "replace":
+		if len(path) == 0 {
+			return value, nil
+		}
+		doc, _, err = remove(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+	case "move", "copy":
+		if op.From == nil {
+			return nil, fmt.Errorf("%w: missing from", ErrMalformedPatch)
+		}
+		from, err := parsePointer(*op.From)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "move" {
+			if len(from) < len(path) && reflect.DeepEqual(from, path[:len(from)]) {
+				return nil, fmt.Errorf("%w: cannot move a value into one of its children", ErrInapplicablePatch)
+			}
+			doc, value, err = remove(doc, from)
+			if err != nil {
+				return nil, err
+			}
+			return add(doc, path, value)
+		}
+		value, err = get(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		js, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		value, err = decode(js)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+	case "test":
+		current, err := get(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(current, value) {
+			return nil, fmt.Errorf("%w at %q", ErrTestFailed, *op.Path)
+		}
+		return doc, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown op %q", ErrMalformedPatch, op.Op)
+	}
+}
+
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: invalid JSON pointer %q", ErrMalformedPatch, pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if allowEnd && token == "-" {
+		return length, nil
+	}
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%w: invalid array index %q", ErrInapplicablePatch, token)
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("%w: invalid array index %q", ErrInapplicablePatch, token)
+	}
+	max := length - 1
+	if allowEnd {
+		max = length
+	}
+	if i > max {
+		return 0, fmt.Errorf("%w: array index %d out of bounds", ErrInapplicablePatch, i)
+	}
+	return i, nil
+}
+
+func get(node interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch container := node.(type) {
+		case map[string]interface{}:
+			child, ok := container[token]
+			if !ok {
+				return nil, fmt.Errorf("%w: path %q does not exist", ErrInapplicablePatch, token)
+			}
+			node = child
+		case []interface{}:
+			i, err := arrayIndex(token, len(container), false)
+			if err != nil {
+				return nil, err
+			}
+			node = container[i]
+		default:
+			return nil, fmt.Errorf("%w: path %q does not exist", ErrInapplicablePatch, token)
+		}
+	}
+	return node, nil
+}
+
+func add(node interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	token := path[0]
+	switch container := node.(type) {
+	case map[string]interface{}:
+		if len(path) == 1 {
+			container[token] = value
+			return container, nil
+		}
+		child, ok := container[token]
+		if !ok {
+			return nil, fmt.Errorf("%w: path %q does not exist", ErrInapplicablePatch, token)
+		}
+		child, err := add(child, path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		container[token] = child
+		return container, nil
+	case []interface{}:
+		if len(path) == 1 {
+			i, err := arrayIndex(token, len(container), true)
+			if err != nil {
+				return nil, err
+			}
+			container = append(container, nil)
+			copy(container[i+1:], container[i:])
+			container[i] = value
+			return container, nil
+		}
+		i, err := arrayIndex(token, len(container), false)
+		if err != nil {
+			return nil, err
+		}
+		child, err := add(container[i], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		container[i] = child
+		return container, nil
+	default:
+		return nil, fmt.Errorf("%w: path %q does not exist", ErrInapplicablePatch, token)
+	}
+}
+
+func remove(node interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("%w: cannot remove the whole document", ErrInapplicablePatch)
+	}
+	token := path[0]
+	switch container := node.(type) {
+	case map[string]interface{}:
+		child, ok := container[token]
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: path %q does not exist", ErrInapplicablePatch, token)
+		}
+		if len(path) == 1 {
+			delete(container, token)
+			return container, child, nil
+		}
+		child, removed, err := remove(child, path[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		container[token] = child
+		return container, removed, nil
+	case []interface{}:
+		i, err := arrayIndex(token, len(container), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(path) == 1 {
+			removed := container[i]
+			return append(container[:i], container[i+1:]...), removed, nil
+		}
+		child, removed, err := remove(container[i], path[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		container[i] = child
+		return container, removed, nil
+	default:
+		return nil, nil, fmt.Errorf("%w: path %q does not exist", ErrInapplicablePatch, token)
+	}
+}
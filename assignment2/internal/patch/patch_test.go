@@ -0,0 +1,212 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func assertJSONEqual(t *testing.T, got []byte, want string) {
+	t.Helper()
+	var g, w interface{}
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("invalid result JSON %s: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatalf("invalid expected JSON %s: %v", want, err)
+	}
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+		err   error
+	}{
+		{
+			name:  "add object member",
+			doc:   `{"foo":"bar"}`,
+			patch: `[{"op":"add","path":"/baz","value":"qux"}]`,
+			want:  `{"baz":"qux","foo":"bar"}`,
+		},
+		{
+			name:  "add array element",
+			doc:   `{"foo":["bar","baz"]}`,
+			patch: `[{"op":"add","path":"/foo/1","value":"qux"}]`,
+			want:  `{"foo":["bar","qux","baz"]}`,
+		},
+		{
+			name:  "add to end of array",
+			doc:   `{"foo":["bar"]}`,
+			patch: `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`,
+			want:  `{"foo":["bar",["abc","def"]]}`,
+		},
+		{
+			name:  "remove object member",
+			doc:   `{"baz":"qux","foo":"bar"}`,
+			patch: `[{"op":"remove","path":"/baz"}]`,
+			want:  `{"foo":"bar"}`,
+		},
+		{
+			name:  "remove array element",
+			doc:   `{"foo":["bar","qux","baz"]}`,
+			patch: `[{"op":"remove","path":"/foo/1"}]`,
+			want:  `{"foo":["bar","baz"]}`,
+		},
+		{
+			name:  "replace value",
+			doc:   `{"baz":"qux","foo":"bar"}`,
+			patch: `[{"op":"replace","path":"/baz","value":"boo"}]`,
+			want:  `{"baz":"boo","foo":"bar"}`,
+		},
+		{
+			name:  "replace whole document",
+			doc:   `{"foo":"bar"}`,
+			patch: `[{"op":"replace","path":"","value":{"baz":"qux"}}]`,
+			want:  `{"baz":"qux"}`,
+		},
+		{
+			name:  "move value",
+			doc:   `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			patch: `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			want:  `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`,
+		},
+		{
+			name:  "move array element",
+			doc:   `{"foo":["all","grass","cows","eat"]}`,
+			patch: `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`,
+			want:  `{"foo":["all","cows","eat","grass"]}`,
+		},
+		{
+			name:  "copy value",
+			doc:   `{"foo":{"bar":1}}`,
+			patch: `[{"op":"copy","from":"/foo","path":"/baz"},{"op":"replace","path":"/baz/bar","value":2}]`,
+			want:  `{"foo":{"bar":1},"baz":{"bar":2}}`,
+		},
+		{
+			name:  "test success",
+			doc:   `{"baz":"qux","foo":["a",2,"c"]}`,
+			patch: `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`,
+			want:  `{"baz":"qux","foo":["a",2,"c"]}`,
+		},
+		{
+			name:  "escaped pointer",
+			doc:   `{"/":9,"~1":10}`,
+			patch: `[{"op":"test","path":"/~01","value":10},{"op":"remove","path":"/~1"}]`,
+			want:  `{"~1":10}`,
+		},
+		{
+			name:  "test failure",
+			doc:   `{"baz":"qux"}`,
+			patch: `[{"op":"test","path":"/baz","value":"bar"}]`,
+			err:   ErrTestFailed,
+		},
+		{
+			name:  "add to missing parent",
+			doc:   `{"foo":"bar"}`,
+			patch: `[{"op":"add","path":"/baz/bat","value":"qux"}]`,
+			err:   ErrInapplicablePatch,
+		},
+		{
+			name:  "array index out of bounds",
+			doc:   `{"foo":["bar"]}`,
+			patch: `[{"op":"add","path":"/foo/5","value":"qux"}]`,
+			err:   ErrInapplicablePatch,
+		},
+		{
+			name:  "move into own child",
+			doc:   `{"foo":{"bar":1}}`,
+			patch: `[{"op":"move","from":"/foo","path":"/foo/bar/baz"}]`,
+			err:   ErrInapplicablePatch,
+		},
+		{
+			name:  "remove whole document",
+			doc:   `{"foo":"bar"}`,
+			patch: `[{"op":"remove","path":""}]`,
+			err:   ErrInapplicablePatch,
+		},
+		{
+			name:  "unknown operation",
+			doc:   `{"foo":"bar"}`,
+			patch: `[{"op":"frobnicate","path":"/foo"}]`,
+			err:   ErrMalformedPatch,
+		},
+		{
+			name:  "missing value",
+			doc:   `{"foo":"bar"}`,
+			patch: `[{"op":"add","path":"/baz"}]`,
+			err:   ErrMalformedPatch,
+		},
+		{
+			name:  "invalid pointer",
+			doc:   `{"foo":"bar"}`,
+			patch: `[{"op":"remove","path":"foo"}]`,
+			err:   ErrMalformedPatch,
+		},
+		{
+			name:  "not an array",
+			doc:   `{"foo":"bar"}`,
+			patch: `{"op":"remove","path":"/foo"}`,
+			err:   ErrMalformedPatch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply([]byte(tt.doc), []byte(tt.patch))
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("got error %v; want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			assertJSONEqual(t, got, tt.want)
+		})
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		doc   string
+		patch string
+		want  string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, tt := range tests {
+		got, err := MergePatch([]byte(tt.doc), []byte(tt.patch))
+		if err != nil {
+			t.Fatalf("MergePatch(%s, %s): unexpected error: %v", tt.doc, tt.patch, err)
+		}
+		assertJSONEqual(t, got, tt.want)
+	}
+}
+
+func TestMergePatchMalformed(t *testing.T) {
+	_, err := MergePatch([]byte(`{"a":"b"}`), []byte(`{"a":`))
+	if !errors.Is(err, ErrMalformedPatch) {
+		t.Errorf("got error %v; want %v", err, ErrMalformedPatch)
+	}
+}
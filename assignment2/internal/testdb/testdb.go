@@ -0,0 +1,83 @@
+package testdb
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+const dsnEnv = "GREENLIGHT_TEST_DB_DSN"
+
+func Open(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv(dsnEnv)
+	if dsn == "" {
+		t.Skipf("%s not set", dsnEnv)
+	}
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := fmt.Sprintf("test_%d_%d", os.Getpid(), time.Now().UnixNano())
+	_, err = admin.Exec("CREATE SCHEMA " + schema)
+	if err != nil {
+		admin.Close()
+		t.Fatal(err)
+	}
+	db, err := sql.Open("postgres", withSearchPath(dsn, schema+",public"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		_, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		if err != nil {
+			t.Error(err)
+		}
+		admin.Close()
+	})
+	migrate(t, db)
+	return db
+}
+
+func withSearchPath(dsn, searchPath string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err == nil {
+			q := u.Query()
+			q.Set("search_path", searchPath)
+			u.RawQuery = q.Encode()
+			return u.String()
+		}
+	}
+	return fmt.Sprintf("%s search_path='%s'", dsn, searchPath)
+}
+
+func migrate(t *testing.T, db *sql.DB) {
+	t.Helper()
+	_, file, _, _ := runtime.Caller(0)
+	files, err := filepath.Glob(filepath.Join(filepath.Dir(file), "..", "..", "migrations", "*.up.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	for _, name := range files {
+		migration, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = db.Exec(string(migration))
+		if err != nil {
+			t.Fatalf("%s: %v", filepath.Base(name), err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const (
+	Digits     = 6
+	Period     = 30
+	secretSize = 20
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func GenerateSecret() ([]byte, error) {
+	secret := make([]byte, secretSize)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+func EncodeSecret(secret []byte) string {
+	return encoding.EncodeToString(secret)
+}
+
+func URI(issuer, account string, secret []byte) string {
+	params := url.Values{}
+	params.Set("secret", EncodeSecret(secret))
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(Digits))
+	params.Set("period", fmt.Sprint(Period))
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+func Step(t time.Time) int64 {
+	return t.Unix() / Period
+}
+
+func Code(secret []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", value%1_000_000)
+}
+
+func Validate(secret []byte, code string, t time.Time, skew int64) (int64, bool) {
+	if len(code) != Digits {
+		return 0, false
+	}
+	current := Step(t)
+	for step := current - skew; step <= current+skew; step++ {
+		if subtle.ConstantTimeCompare([]byte(Code(secret, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,95 @@
+package totp
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+var rfcSecret = []byte("12345678901234567890")
+
+func TestCode(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if got != tt.want {
+			t.Errorf("Code at %d: got %s; want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+	tests := []struct {
+		name     string
+		code     string
+		wantStep int64
+		ok       bool
+	}{
+		{"current step", Code(rfcSecret, current), current, true},
+		{"previous step", Code(rfcSecret, current-1), current - 1, true},
+		{"next step", Code(rfcSecret, current+1), current + 1, true},
+		{"outside skew", Code(rfcSecret, current-2), 0, false},
+		{"wrong code", "000000", 0, false},
+		{"wrong length", "12345", 0, false},
+	}
+	for _, tt := range tests {
+		step, ok := Validate(rfcSecret, tt.code, now, 1)
+		if ok != tt.ok || step != tt.wantStep {
+			t.Errorf("%s: got (%d, %t); want (%d, %t)", tt.name, step, ok, tt.wantStep, tt.ok)
+		}
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	a, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a) != 20 || string(a) == string(b) {
+		t.Errorf("unexpected secrets %x and %x", a, b)
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("Greenlight", "alice@example.com", rfcSecret)
+	u, err := url.Parse(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Greenlight:alice@example.com" {
+		t.Errorf("unexpected URI %s", uri)
+	}
+	qs := u.Query()
+	want := map[string]string{
+		"secret":    "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+		"issuer":    "Greenlight",
+		"algorithm": "SHA1",
+		"digits":    "6",
+		"period":    "30",
+	}
+	for key, value := range want {
+		if qs.Get(key) != value {
+			t.Errorf("%s: got %q; want %q", key, qs.Get(key), value)
+		}
+	}
+	if strings.Contains(qs.Get("secret"), "=") {
+		t.Error("secret must not be padded")
+	}
+}
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS saved_searches (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text NOT NULL,
+    query text NOT NULL,
+    last_seen_id bigint NOT NULL DEFAULT 0,
+    last_notified_at timestamp(0) with time zone,
+    version integer NOT NULL DEFAULT 1
+);
+CREATE INDEX IF NOT EXISTS saved_searches_user_id_idx ON saved_searches(user_id);
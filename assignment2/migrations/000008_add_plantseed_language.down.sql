@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS plantseed_name_language_idx;
+DROP INDEX IF EXISTS plantseed_family_language_idx;
+ALTER TABLE plantseed DROP COLUMN IF EXISTS language;
+CREATE INDEX IF NOT EXISTS plantseed_name_idx ON plantseed USING GIN(to_tsvector('simple', name));
+CREATE INDEX IF NOT EXISTS plantseed_family_idx ON plantseed USING GIN(to_tsvector('simple', family));
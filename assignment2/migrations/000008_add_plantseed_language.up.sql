@@ -0,0 +1,5 @@
+ALTER TABLE plantseed ADD COLUMN IF NOT EXISTS language regconfig NOT NULL DEFAULT 'simple';
+DROP INDEX IF EXISTS plantseed_name_idx;
+DROP INDEX IF EXISTS plantseed_family_idx;
+CREATE INDEX IF NOT EXISTS plantseed_name_language_idx ON plantseed USING GIN(to_tsvector(language, name));
+CREATE INDEX IF NOT EXISTS plantseed_family_language_idx ON plantseed USING GIN(to_tsvector(language, family));
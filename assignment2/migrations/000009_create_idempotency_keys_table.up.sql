@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    key text NOT NULL,
+    fingerprint bytea NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    expiry timestamp(0) with time zone NOT NULL,
+    status integer,
+    headers jsonb,
+    body bytea,
+    PRIMARY KEY (user_id, key)
+);
+CREATE INDEX IF NOT EXISTS idempotency_keys_expiry_idx ON idempotency_keys(expiry);
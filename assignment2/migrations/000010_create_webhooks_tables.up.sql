@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS webhooks (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    url text NOT NULL,
+    secret text NOT NULL,
+    event_types text[] NOT NULL,
+    active boolean NOT NULL DEFAULT true,
+    version integer NOT NULL DEFAULT 1
+);
+CREATE INDEX IF NOT EXISTS webhooks_user_id_idx ON webhooks(user_id);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id bigserial PRIMARY KEY,
+    webhook_id bigint NOT NULL REFERENCES webhooks ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    event_id bigint NOT NULL,
+    event_type text NOT NULL,
+    payload jsonb NOT NULL,
+    status text NOT NULL DEFAULT 'pending',
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    last_attempt_at timestamp(0) with time zone,
+    last_response_status integer NOT NULL DEFAULT 0,
+    last_error text NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_id_idx ON webhook_deliveries(webhook_id);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+
+INSERT INTO permissions (code)
+VALUES ('webhooks:manage');
@@ -0,0 +1,6 @@
+CREATE SEQUENCE IF NOT EXISTS token_families_seq;
+ALTER TABLE tokens
+    ADD COLUMN IF NOT EXISTS family bigint,
+    ADD COLUMN IF NOT EXISTS used_at timestamp(0) with time zone;
+UPDATE tokens SET family = nextval('token_families_seq') WHERE scope = 'authentication' AND family IS NULL;
+CREATE INDEX IF NOT EXISTS tokens_family_idx ON tokens(family);
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id bigint PRIMARY KEY REFERENCES users ON DELETE CASCADE,
+    secret bytea NOT NULL,
+    confirmed bool NOT NULL DEFAULT false,
+    last_used_step bigint NOT NULL DEFAULT 0,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    hash bytea NOT NULL,
+    used_at timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS recovery_codes_user_id_idx ON recovery_codes(user_id);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS login_attempts (
+    kind text NOT NULL,
+    key text NOT NULL,
+    failures integer NOT NULL DEFAULT 0,
+    lockouts integer NOT NULL DEFAULT 0,
+    last_failure_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    locked_until timestamp(0) with time zone,
+    PRIMARY KEY (kind, key)
+);
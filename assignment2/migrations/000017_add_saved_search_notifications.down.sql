@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS saved_search_notifications;
+ALTER TABLE saved_searches ADD COLUMN IF NOT EXISTS last_seen_id bigint NOT NULL DEFAULT 0;
+ALTER TABLE saved_searches DROP COLUMN IF EXISTS last_seen_at;
+DROP INDEX IF EXISTS plantseed_updated_at_idx;
+ALTER TABLE plantseed DROP COLUMN IF EXISTS updated_at;
@@ -0,0 +1,12 @@
+ALTER TABLE plantseed ADD COLUMN IF NOT EXISTS updated_at timestamp with time zone NOT NULL DEFAULT NOW();
+CREATE INDEX IF NOT EXISTS plantseed_updated_at_idx ON plantseed(updated_at, id);
+
+ALTER TABLE saved_searches ADD COLUMN IF NOT EXISTS last_seen_at timestamp with time zone NOT NULL DEFAULT NOW();
+ALTER TABLE saved_searches DROP COLUMN IF EXISTS last_seen_id;
+
+CREATE TABLE IF NOT EXISTS saved_search_notifications (
+    saved_search_id bigint NOT NULL REFERENCES saved_searches ON DELETE CASCADE,
+    plantseed_id bigint NOT NULL REFERENCES plantseed ON DELETE CASCADE,
+    notified_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (saved_search_id, plantseed_id)
+);
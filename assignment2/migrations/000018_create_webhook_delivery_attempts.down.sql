@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS webhook_delivery_attempts;
+DROP SEQUENCE IF EXISTS event_id_seq;
@@ -0,0 +1,10 @@
+CREATE SEQUENCE IF NOT EXISTS event_id_seq;
+
+CREATE TABLE IF NOT EXISTS webhook_delivery_attempts (
+    id bigserial PRIMARY KEY,
+    delivery_id bigint NOT NULL REFERENCES webhook_deliveries ON DELETE CASCADE,
+    attempted_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    response_status integer NOT NULL DEFAULT 0,
+    error text NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS webhook_delivery_attempts_delivery_id_idx ON webhook_delivery_attempts(delivery_id);